@@ -1,6 +1,7 @@
 package gopq
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/mattdeak/gopq/internal"
@@ -11,41 +12,69 @@ const (
         CREATE TABLE IF NOT EXISTS %[1]s (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             item BLOB NOT NULL,
-            enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            enqueued_at INTEGER,
             processed_at TIMESTAMP,
             ack_deadline INTEGER,
-            retry_count INTEGER DEFAULT 0
+            retry_count INTEGER DEFAULT 0,
+            visible_at INTEGER,
+            attributes TEXT,
+            expires_at INTEGER,
+            first_attempt_at INTEGER,
+            last_attempt_at INTEGER,
+            failures TEXT,
+            codec TEXT
         );
-        CREATE INDEX IF NOT EXISTS idx_processed ON %[1]s(processed_at);
-        CREATE INDEX IF NOT EXISTS idx_ack_deadline ON %[1]s(ack_deadline);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_processed ON %[1]s(processed_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_ack_deadline ON %[1]s(ack_deadline);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_visible_at ON %[1]s(visible_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s(expires_at);
     `
 	ackEnqueueQuery = `
-        INSERT INTO %s (item) VALUES (?)
+        INSERT INTO %s (item, expires_at, codec, enqueued_at) VALUES (?, ?, ?, ?)
     `
 	ackTryDequeueQuery = `
 		WITH oldest AS (
 			SELECT id, item
 			FROM %[1]s
-			WHERE processed_at IS NULL AND (ack_deadline < ? OR ack_deadline IS NULL)
-			ORDER BY enqueued_at ASC
+			WHERE processed_at IS NULL AND (ack_deadline < ?1 OR ack_deadline IS NULL)
+				AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
 			LIMIT 1
 		)
 		UPDATE %[1]s 
-		SET ack_deadline = ?
+		SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1
 		WHERE id = (SELECT id FROM oldest)
-		RETURNING id, item
+		RETURNING id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
+    `
+	ackTryDequeueBatchQuery = `
+		WITH batch AS MATERIALIZED (
+			SELECT id, row_number() OVER (ORDER BY enqueued_at ASC, id ASC) AS position
+			FROM %[1]s
+			WHERE processed_at IS NULL AND (ack_deadline < ?1 OR ack_deadline IS NULL)
+				AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
+			LIMIT ?3
+		)
+		UPDATE %[1]s
+		SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1
+		WHERE id IN (SELECT id FROM batch)
+		RETURNING (SELECT position FROM batch WHERE batch.id = %[1]s.id), id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
     `
 	ackAckQuery = `
 		UPDATE %s 
-		SET processed_at = CURRENT_TIMESTAMP 
-		WHERE id = ? AND ack_deadline >= ?
+		SET processed_at = datetime(?2 / 1000.0, 'unixepoch') 
+		WHERE id = ?1 AND ack_deadline >= ?2
 	`
 	ackAckDelete = `
 		delete from %s 
 		where id = ? and ack_deadline >= ?
 	`
 	ackLenQuery = `
-        SELECT COUNT(*) FROM %s WHERE processed_at IS NULL AND (ack_deadline IS NULL OR ack_deadline < ?)
+        SELECT COUNT(*) FROM %s WHERE processed_at IS NULL AND (ack_deadline IS NULL OR ack_deadline < ?1)
+            AND (visible_at IS NULL OR visible_at <= ?1)
+            AND (expires_at IS NULL OR expires_at > ?1)
     `
 )
 
@@ -63,38 +92,95 @@ func NewAckQueue(filePath string, opts AckOpts) (*AcknowledgeableQueue, error) {
 	}
 
 	tableName := internal.DetermineTableName("ack_queue", filePath)
+	return newAckQueue(db, tableName, internal.MakeNotifyChan(), opts)
+}
 
+// newAckQueue creates an ack queue in the given table of db.
+func newAckQueue(db *sql.DB, tableName string, notifyChan chan struct{}, opts AckOpts) (*AcknowledgeableQueue, error) {
 	formattedCreateTableQuery := fmt.Sprintf(ackCreateTableQuery, tableName)
 	formattedEnqueueQuery := fmt.Sprintf(ackEnqueueQuery, tableName)
 	formattedTryDequeueQuery := fmt.Sprintf(ackTryDequeueQuery, tableName)
+	formattedTryDequeueBatchQuery := fmt.Sprintf(ackTryDequeueBatchQuery, tableName)
 	formattedAckQuery := fmt.Sprintf(ackAckActs[opts.AckAction], tableName)
 	formattedLenQuery := fmt.Sprintf(ackLenQuery, tableName)
+	formattedEnqueueAtQuery := fmt.Sprintf(delayedEnqueueQuery, tableName)
+	formattedEnqueueAttributesQuery := fmt.Sprintf(attributesEnqueueQuery, tableName)
+	formattedNextVisibleQuery := fmt.Sprintf(delayedNextVisibleQuery, tableName)
+	formattedLenExpiredQuery := fmt.Sprintf(ttlLenExpiredQuery, tableName, ackExpiredCondition)
+	formattedSelectExpiredQuery := fmt.Sprintf(ttlAckSelectExpiredQuery, tableName, ackExpiredCondition)
+	formattedPurgeExpiredQuery := fmt.Sprintf(ttlAckPurgeExpiredQuery, tableName, ackExpiredCondition)
+	formattedPeekQuery := fmt.Sprintf(browseAckQuery, tableName, ackReadyCondition, fifoOrder)
+	formattedBrowseQuery := fmt.Sprintf(browseAckQuery, tableName, pendingCondition, fifoOrder)
+	formattedDeleteByIDQuery := fmt.Sprintf(adminDeleteQuery, tableName)
+	formattedPurgePendingQuery := fmt.Sprintf(adminPurgeQuery, tableName, unprocessedFilter)
+	formattedPurgeAllQuery := fmt.Sprintf(adminPurgeQuery, tableName, "")
+	formattedRequeueQuery := fmt.Sprintf(adminRequeueQuery, tableName, ackRequeueSet)
+	formattedCompactAgeQuery := fmt.Sprintf(compactAgeQuery, tableName)
+	formattedCompactCountQuery := fmt.Sprintf(compactCountQuery, tableName)
 
-	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedAckQuery, formattedLenQuery)
+	common, err := opts.CommonOpts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	err = internal.MigrateTable(db, tableName, ackAddedColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ack queue: %w", err)
+	}
+	err = internal.MigrateMillis(db, tableName, millisColumns...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ack queue: %w", err)
 	}
 
-	return &AcknowledgeableQueue{
+	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedTryDequeueBatchQuery, formattedAckQuery, formattedLenQuery, formattedEnqueueAtQuery, formattedEnqueueAttributesQuery, formattedNextVisibleQuery, formattedLenExpiredQuery, formattedSelectExpiredQuery, formattedPurgeExpiredQuery, formattedPeekQuery, formattedBrowseQuery, formattedDeleteByIDQuery, formattedPurgePendingQuery, formattedPurgeAllQuery, formattedRequeueQuery, formattedCompactAgeQuery, formattedCompactCountQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ack queue: %w", err)
+	}
+
+	q := &AcknowledgeableQueue{
 		Queue: Queue{
 			db:           db,
+			name:         tableName,
 			pollInterval: defaultPollInterval,
-			notifyChan:   internal.MakeNotifyChan(),
+			notifyChan:   notifyChan,
 			queries: baseQueries{
-				enqueue:    formattedEnqueueQuery,
-				tryDequeue: formattedTryDequeueQuery,
-				len:        formattedLenQuery,
+				enqueue:           formattedEnqueueQuery,
+				enqueueAt:         formattedEnqueueAtQuery,
+				enqueueAttributes: formattedEnqueueAttributesQuery,
+				tryDequeue:        formattedTryDequeueQuery,
+				tryDequeueBatch:   formattedTryDequeueBatchQuery,
+				len:               formattedLenQuery,
+				nextVisible:       formattedNextVisibleQuery,
+				lenExpired:        formattedLenExpiredQuery,
+				selectExpired:     formattedSelectExpiredQuery,
+				purgeExpired:      formattedPurgeExpiredQuery,
+				peek:              formattedPeekQuery,
+				browse:            formattedBrowseQuery,
+				deleteByID:        formattedDeleteByIDQuery,
+				purgePending:      formattedPurgePendingQuery,
+				purgeAll:          formattedPurgeAllQuery,
+				requeue:           formattedRequeueQuery,
+				compactAge:        formattedCompactAgeQuery,
+				compactCount:      formattedCompactCountQuery,
+				vacuum:            compactVacuumQuery,
 			},
+			opts: common,
+			mode: modeCodec,
 		},
 		AckOpts: opts,
 		ackQueries: ackQueries{
 			ack: formattedAckQuery,
 			ackUtilsQueries: ackUtilsQueries{
-				details:  fmt.Sprintf(sqlite.details, tableName),
-				delete:   fmt.Sprintf(sqlite.delete, tableName),
-				forRetry: fmt.Sprintf(sqlite.forRetry, tableName),
-				expire:   fmt.Sprintf(sqlite.expire, tableName),
+				details:       fmt.Sprintf(sqlite.details, tableName),
+				delete:        fmt.Sprintf(sqlite.delete, tableName),
+				forRetry:      fmt.Sprintf(sqlite.forRetry, tableName),
+				expire:        fmt.Sprintf(sqlite.expire, tableName),
+				extend:        fmt.Sprintf(sqlite.extend, tableName),
+				recordFailure: fmt.Sprintf(sqlite.recordFailure, tableName),
 			},
 		},
-	}, nil
+	}
+	q.onExpired = q.runExpiredCallback
+	q.startJanitor()
+	return q, nil
 }
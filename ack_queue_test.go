@@ -2,6 +2,7 @@ package gopq_test
 
 import (
 	"context"
+	"database/sql"
 	"os"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -127,6 +129,29 @@ func TestAckQueue_Ack(t *testing.T) {
 	}
 }
 
+func TestAckQueue_DefaultAckActionMarks(t *testing.T) {
+	assert.Equal(t, gopq.AckMark, gopq.AckOpts{}.AckAction)
+
+	tempFile := tempFilePath(t)
+	defer os.Remove(tempFile)
+	q, err := gopq.NewAckQueue(tempFile, gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Enqueue([]byte("test item")))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.Ack(msg.ID))
+
+	// The acknowledged item is kept and marked as processed.
+	db, err := sql.Open("sqlite3", tempFile)
+	require.NoError(t, err)
+	defer db.Close()
+	var processed int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM ack_queue WHERE processed_at IS NOT NULL").Scan(&processed))
+	assert.Equal(t, 1, processed)
+}
+
 func TestAckQueue_Len(t *testing.T) {
 	q := setupDefaultTestAckQueue(t)
 
@@ -309,3 +334,19 @@ func setupTestAckQueue(t *testing.T, opts gopq.AckOpts) *gopq.AcknowledgeableQue
 	}
 	return q
 }
+
+func TestAckQueue_ZeroAckTimeout(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{CommonOpts: gopq.CommonOpts{Clock: clock}})
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+
+	// Without an AckTimeout, the message is delivered again as soon as
+	// the clock moves on.
+	clock.Advance(time.Millisecond)
+	again, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, msg.ID, again.ID)
+}
@@ -9,7 +9,11 @@ import (
 
 var sqlite = ackUtilsQueries{
 	details: "SELECT retry_count, ack_deadline FROM %s WHERE id = ?",
-	delete:  "DELETE FROM %s WHERE id = ? RETURNING item",
+	delete: `
+		DELETE FROM %s WHERE id = ?
+		RETURNING item, attributes, CAST(enqueued_at AS INTEGER), retry_count,
+			first_attempt_at, last_attempt_at, failures, codec
+	`,
 	forRetry: `
 		UPDATE %s 
 		SET ack_deadline = ?, retry_count = retry_count + 1
@@ -20,10 +24,23 @@ var sqlite = ackUtilsQueries{
 		SET ack_deadline = ?
 		WHERE id = ?
 	`,
+	extend: `
+		UPDATE %s
+		SET ack_deadline = ?1
+		WHERE id = ?2 AND processed_at IS NULL AND ack_deadline >= ?3
+	`,
+	recordFailure: `
+		UPDATE %s
+		SET failures = json_insert(COALESCE(failures, '[]'), '$[#]', json_object('at', ?1, 'error', ?2))
+		WHERE id = ?3
+	`,
 }
 
-func (q *ackQueries) nackImpl(ctx context.Context, db *sql.DB, id int64, opts AckOpts) error {
-	tx, err := db.BeginTx(ctx, nil)
+// nack negatively acknowledges a message. The message is delivered again
+// after the delay returned for its upcoming retry. A non-empty reason is
+// added to the failure history of the message.
+func (q *AcknowledgeableQueue) nack(ctx context.Context, id int64, delay func(retry int) time.Duration, reason string) error {
+	tx, err := q.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -31,62 +48,167 @@ func (q *ackQueries) nackImpl(ctx context.Context, db *sql.DB, id int64, opts Ac
 		_ = tx.Rollback() // will fail if committed, but that's fine
 	}()
 
+	failed, err := q.nackTx(ctx, tx, id, q.opts.Clock.Now(), delay, reason)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if failed != nil {
+		return runFailureCallbacks(q.AckOpts, *failed)
+	}
+	return nil
+}
+
+// nackTx negatively acknowledges a message within tx. A message that has
+// exhausted its retries is deleted and returned, so that the failure
+// callbacks can run once the transaction is committed.
+func (q *AcknowledgeableQueue) nackTx(ctx context.Context, tx *sql.Tx, id int64, now time.Time, delay func(retry int) time.Duration, reason string) (*DeadLetter, error) {
 	var retryCount int
-	var ackDeadline int64
-	err = tx.QueryRow(q.details, id).Scan(&retryCount, &ackDeadline)
+	var ackDeadline sql.NullInt64
+	err := tx.QueryRowContext(ctx, q.ackQueries.details, id).Scan(&retryCount, &ackDeadline)
+	if err == sql.ErrNoRows {
+		return nil, &ErrMessageNotFound{ID: id}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get item details: %w", err)
+		return nil, fmt.Errorf("failed to get item details: %w", err)
 	}
 
-	// Check if the ack deadline has expired
-	if ackDeadline < time.Now().Unix() {
-		return fmt.Errorf("ack deadline has expired, cannot nack")
+	// Check if the ack deadline has expired. A message without a deadline
+	// has never been dequeued.
+	if !ackDeadline.Valid || ackDeadline.Int64 < now.UnixMilli() {
+		return nil, &ErrAckDeadlineExpired{ID: id}
+	}
+
+	if reason != "" && q.ackQueries.recordFailure != "" {
+		_, err = tx.ExecContext(ctx, q.ackQueries.recordFailure, now.UnixMilli(), reason, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record failure: %w", err)
+		}
 	}
 
 	// Check if we have reached the maximum number of retries
-	if retryCount >= opts.MaxRetries && opts.MaxRetries != InfiniteRetries {
-		return q.handleTooManyRetries(tx, id, opts)
+	if retryCount >= q.MaxRetries && q.MaxRetries != InfiniteRetries {
+		dl, err := q.deleteFailed(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		dl.Queue = q.name
+		return dl, nil
 	}
 
-	// Use the maximum of retryBackoff and ackTimeout
-	newDeadline := time.Now().Add(max(opts.RetryBackoff, opts.AckTimeout)).Unix()
-	_, err = tx.Exec(q.forRetry, newDeadline, id)
+	newDeadline := now.Add(delay(retryCount + 1)).UnixMilli()
+	_, err = tx.ExecContext(ctx, q.ackQueries.forRetry, newDeadline, id)
 	if err != nil {
-		return fmt.Errorf("failed to update item for retry: %w", err)
+		return nil, fmt.Errorf("failed to update item for retry: %w", err)
 	}
 
-	err = tx.Commit()
+	return nil, nil
+}
+
+// deleteFailed removes a message that has exhausted its retries and returns
+// its dead letter record. The row holds the item, the attributes, the enqueue
+// time, the retry count, the first and last attempt times, the failures and
+// the codec of the item. Rows returned by external procedures have no codec
+// and may omit trailing columns after the item.
+func (q *AcknowledgeableQueue) deleteFailed(ctx context.Context, tx *sql.Tx, id int64) (*DeadLetter, error) {
+	rows, err := tx.QueryContext(ctx, q.ackQueries.delete, id)
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to delete item for on failure: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to delete item for on failure: %w", err)
+		}
+		return nil, &ErrMessageNotFound{ID: id}
+	}
+
+	dl := DeadLetter{Msg: Msg{ID: id}}
+	var attributes, failures, codec sql.NullString
+	var enqueuedAt, retryCount, firstAttempt, lastAttempt sql.NullInt64
+	dest := []any{&dl.Item, &attributes, &enqueuedAt, &retryCount, &firstAttempt, &lastAttempt, &failures}
+	if q.mode.is(modeExternal) {
+		err = scanOptional(rows, dest...)
+	} else {
+		err = rows.Scan(append(dest, &codec)...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete item for on failure: %w", err)
+	}
+	dl.Item, err = decompress(dl.Item, codec)
+	if err != nil {
+		return nil, err
+	}
+	dl.Attributes, err = decodeAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+	dl.Failures, err = decodeFailures(failures)
+	if err != nil {
+		return nil, err
+	}
+
+	dl.RetryCount = int(retryCount.Int64)
+	dl.Attempts = dl.RetryCount + 1
+	if enqueuedAt.Valid {
+		dl.EnqueuedAt = time.UnixMilli(enqueuedAt.Int64)
+	}
+	if firstAttempt.Valid {
+		dl.FirstAttemptAt = time.UnixMilli(firstAttempt.Int64)
+	}
+	if lastAttempt.Valid {
+		dl.LastAttemptAt = time.UnixMilli(lastAttempt.Int64)
+	}
+	if len(dl.Failures) > 0 {
+		dl.LastError = dl.Failures[len(dl.Failures)-1].Error
+	}
+	return &dl, nil
 }
 
-func (q *ackQueries) handleTooManyRetries(tx *sql.Tx, id int64, opts AckOpts) error {
-	var item []byte
-	err := tx.QueryRow(q.delete, id).Scan(&item)
+// ackTx acknowledges a message within tx.
+func (q *ackQueries) ackTx(ctx context.Context, tx *sql.Tx, id int64, now int64) error {
+	res, err := tx.ExecContext(ctx, q.ack, id, now)
 	if err != nil {
-		return fmt.Errorf("failed to delete item for on failure: %w", err)
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
 	}
 
-	err = tx.Commit()
+	// Nothing was acknowledged, find out why.
+	var retryCount int
+	var ackDeadline sql.NullInt64
+	err = tx.QueryRowContext(ctx, q.details, id).Scan(&retryCount, &ackDeadline)
+	if err == sql.ErrNoRows {
+		return &ErrMessageNotFound{ID: id}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to get item details: %w", err)
 	}
+	return &ErrAckDeadlineExpired{ID: id}
+}
 
-	if len(opts.FailureCallbacks) > 0 {
-		for _, fn := range opts.FailureCallbacks {
-			err := fn(Msg{
-				ID:   id,
-				Item: item,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to execute failure callback: %w", err)
-			}
+// runFailureCallbacks hands a message that has exhausted its retries
+// to the registered failure and dead letter callbacks.
+func runFailureCallbacks(opts AckOpts, dl DeadLetter) error {
+	for _, fn := range opts.FailureCallbacks {
+		err := fn(dl.Msg)
+		if err != nil {
+			return fmt.Errorf("failed to execute failure callback: %w", err)
+		}
+	}
+	for _, fn := range opts.DeadLetterCallbacks {
+		err := fn(dl)
+		if err != nil {
+			return fmt.Errorf("failed to execute dead letter callback: %w", err)
 		}
 	}
-
 	return nil
 }
 
@@ -98,9 +220,9 @@ func max(a, b time.Duration) time.Duration {
 	return b
 }
 
-func (q *ackQueries) expireAckDeadline(db *sql.DB, id int64) error {
+func (q *ackQueries) expireAckDeadline(db *sql.DB, id int64, now time.Time) error {
 	// expiredTime is 1 second in the past to ensure that the ack deadline is expired
-	expiredTime := time.Now().Add(-1 * time.Second).Unix()
+	expiredTime := now.Add(-1 * time.Second).UnixMilli()
 	_, err := db.Exec(q.expire, expiredTime, id)
 	return err
 }
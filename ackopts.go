@@ -1,12 +1,17 @@
 package gopq
 
-import "time"
+import (
+	"context"
+	"time"
+)
+
+// InfiniteRetries disables the retry limit when used as AckOpts.MaxRetries.
+const InfiniteRetries = -1
 
 // AckOpts represents the queue-level settings for how acknowledgement
 // of messages is handled.
 const (
-	InfiniteRetries           = -1
-	AckMark         AckAction = iota
+	AckMark AckAction = iota
 	AckDelete
 )
 
@@ -14,10 +19,18 @@ type (
 	AckAction int
 
 	AckOpts struct {
+		// AckTimeout is how long a dequeued message waits for its
+		// acknowledgement before it is delivered again. With zero, an
+		// unacknowledged message can be delivered again right away.
 		AckTimeout   time.Duration
 		MaxRetries   int
 		RetryBackoff time.Duration
 
+		// BackoffPolicy determines the delay before each retry of a
+		// negatively acknowledged message. If it is nil, every retry waits
+		// for the larger of RetryBackoff and AckTimeout.
+		BackoffPolicy BackoffPolicy
+
 		// AckAction determines the fate of the related database record when the
 		// message is acknowledged.
 		// - AckMark (default behaivour) marks the record as done
@@ -27,6 +40,20 @@ type (
 		// Has a default behaviour of dropping the message
 		BehaviourOnFailure func(msg Msg) error
 		FailureCallbacks   []func(msg Msg) error
+
+		// DeadLetterCallbacks are called after the FailureCallbacks with the
+		// dead letter record of the failed message.
+		DeadLetterCallbacks []func(dl DeadLetter) error
+
+		// ExpiredCallbacks are called with the expired messages removed by
+		// PurgeExpired or in the background. If ExpireAsFailure is set, the
+		// FailureCallbacks are called for them as well.
+		ExpiredCallbacks []func(msg Msg) error
+		ExpireAsFailure  bool
+
+		// CommonOpts take precedence over the QueueOptions of constructors
+		// that accept both.
+		CommonOpts
 	}
 )
 
@@ -37,9 +64,20 @@ func (q *AcknowledgeableQueue) RegisterOnFailureCallback(fn func(msg Msg) error)
 }
 
 // RegisterDeadLetterQueue sets the dead letter queue for this AcknowledgeableQueue.
-// This is shorthand for RegisterFailureCallback -> dlq.Enqueue.
+// This is shorthand for RegisterOnDeadLetterCallback -> dlq.Enqueue.
+// If the dead letter queue supports attributes, the attributes of the message
+// are carried over and the fields of its DeadLetter record are added to them;
+// ParseDeadLetter reads them back.
 func (q *AcknowledgeableQueue) RegisterDeadLetterQueue(dlq Enqueuer) {
-	q.RegisterOnFailureCallback(func(msg Msg) error {
-		return dlq.Enqueue(msg.Item)
+	q.RegisterOnDeadLetterCallback(func(dl DeadLetter) error {
+		ae, ok := dlq.(attributeEnqueuer)
+		if !ok {
+			return dlq.Enqueue(dl.Item)
+		}
+		attributes, err := deadLetterAttributes(dl)
+		if err != nil {
+			return err
+		}
+		return ae.EnqueueWithAttributes(context.Background(), dl.Item, attributes)
 	})
 }
@@ -0,0 +1,115 @@
+package gopq
+
+import (
+	"context"
+	"fmt"
+)
+
+// PurgeMode selects the items removed by Purge.
+type PurgeMode int
+
+const (
+	// PurgePending removes the items that have not been processed yet,
+	// including delayed, expired and in-flight items.
+	PurgePending PurgeMode = iota
+	// PurgeAll removes all items, including processed items kept by queues
+	// that mark items instead of deleting them.
+	PurgeAll
+)
+
+const (
+	adminDeleteQuery = `
+        DELETE FROM %s WHERE id = ?
+    `
+	adminPurgeQuery = `
+        DELETE FROM %[1]s%[2]s
+    `
+	adminRequeueQuery = `
+        UPDATE %[1]s SET %[2]s WHERE id = ?
+    `
+
+	// unprocessedFilter restricts a purge to pending items. Unique queues
+	// delete items when they are processed, so they do not need it unless
+	// they remember processed items.
+	unprocessedFilter = " WHERE processed_at IS NULL"
+
+	// The columns reset by Requeue for each kind of queue.
+	requeueSet          = "processed_at = NULL, visible_at = NULL"
+	uniqueRequeueSet    = "visible_at = NULL"
+	ackRequeueSet       = "processed_at = NULL, visible_at = NULL, ack_deadline = NULL, retry_count = 0"
+	uniqueAckRequeueSet = "visible_at = NULL, ack_deadline = NULL, retry_count = 0"
+)
+
+// DeleteByID removes the item with the given ID from the queue, whatever
+// its state. It returns ErrMessageNotFound if the queue holds no such item.
+func (q *Queue) DeleteByID(ctx context.Context, id int64) error {
+	if q.queries.deleteByID == "" {
+		return &ErrUnsupported{Op: "DeleteByID"}
+	}
+	res, err := q.db.ExecContext(ctx, q.queries.deleteByID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete item: %w", err)
+	}
+	return checkFound(res.RowsAffected, id)
+}
+
+// Purge removes the items selected by mode from the queue and returns how
+// many were removed. Items waiting for an acknowledgement are removed as
+// well; acknowledging them afterwards has no effect.
+func (q *Queue) Purge(ctx context.Context, mode PurgeMode) (int, error) {
+	var query string
+	switch mode {
+	case PurgePending:
+		query = q.queries.purgePending
+	case PurgeAll:
+		query = q.queries.purgeAll
+	default:
+		return 0, fmt.Errorf("unknown purge mode: %d", mode)
+	}
+	if query == "" {
+		return 0, &ErrUnsupported{Op: "Purge"}
+	}
+
+	res, err := q.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge queue: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge queue: %w", err)
+	}
+	return int(n), nil
+}
+
+// Requeue makes the item with the given ID available to the next dequeue
+// again. It clears any delay and, for acknowledgeable queues, the ack
+// deadline and retry count. Processed items that are still stored are
+// delivered again. Expired items stay expired.
+// It returns ErrMessageNotFound if the queue holds no such item.
+func (q *Queue) Requeue(ctx context.Context, id int64) error {
+	if q.queries.requeue == "" {
+		return &ErrUnsupported{Op: "Requeue"}
+	}
+	res, err := q.db.ExecContext(ctx, q.queries.requeue, id)
+	if err != nil {
+		return fmt.Errorf("failed to requeue item: %w", err)
+	}
+	if err := checkFound(res.RowsAffected, id); err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+// checkFound returns ErrMessageNotFound if a statement on the item with the
+// given ID did not affect any row.
+func checkFound(rowsAffected func() (int64, error), id int64) error {
+	n, err := rowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &ErrMessageNotFound{ID: id}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package gopq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestQueue_DeleteByID(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("poison")))
+	require.NoError(t, q.Enqueue([]byte("good")))
+	msgs, err := q.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+
+	require.NoError(t, q.DeleteByID(ctx, msgs[0].ID))
+	assertQueueLen(t, q, 1)
+
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, q.DeleteByID(ctx, msgs[0].ID), &notFound)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "good", string(msg.Item))
+}
+
+func TestQueue_Purge(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Enqueue([]byte(item)))
+	}
+	_, err := q.TryDequeue()
+	require.NoError(t, err)
+
+	n, err := q.Purge(ctx, gopq.PurgePending)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assertQueueLen(t, q, 0)
+
+	// The processed item is still stored.
+	n, err = q.Purge(ctx, gopq.PurgeAll)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = q.Purge(ctx, gopq.PurgeMode(42))
+	assert.Error(t, err)
+}
+
+func TestUniqueQueue_Purge(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("a")))
+	require.NoError(t, q.Enqueue([]byte("b")))
+
+	n, err := q.Purge(ctx, gopq.PurgePending)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Purged items may be enqueued again.
+	require.NoError(t, q.Enqueue([]byte("a")))
+	assertQueueLen(t, q, 1)
+}
+
+func TestAckQueue_Requeue(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, MaxRetries: 3, RetryBackoff: time.Hour})
+	ctx := context.Background()
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.Nack(msg.ID))
+	assertLen(t, q, 0)
+
+	require.NoError(t, q.Requeue(ctx, msg.ID))
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, 0, msg.RetryCount)
+
+	// Acknowledged items are delivered again as well.
+	require.NoError(t, q.Ack(msg.ID))
+	require.NoError(t, q.Requeue(ctx, msg.ID))
+	assertLen(t, q, 1)
+
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, q.Requeue(ctx, 12345), &notFound)
+}
+
+func TestAckQueue_DeleteInFlight(t *testing.T) {
+	q := setupDefaultTestAckQueue(t)
+	ctx := context.Background()
+	require.NoError(t, q.Enqueue([]byte("stuck")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.DeleteByID(ctx, msg.ID))
+
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, q.Nack(msg.ID), &notFound)
+}
+
+func TestTopic_GroupAdmin(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+
+	first, err := topic.Subscribe("first", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	second, err := topic.Subscribe("second", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	require.NoError(t, topic.Publish(ctx, []byte("item")))
+
+	msg, err := first.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, first.Requeue(ctx, msg.ID))
+	assertLen(t, first, 1)
+
+	n, err := first.Purge(ctx, gopq.PurgePending)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assertLen(t, first, 0)
+
+	// Other groups are not affected.
+	assertLen(t, second, 1)
+	msgs, err := second.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, first.DeleteByID(ctx, msgs[0].ID), &notFound)
+	require.NoError(t, second.DeleteByID(ctx, msgs[0].ID))
+	assertLen(t, second, 0)
+}
@@ -0,0 +1,64 @@
+package gopq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	attributesEnqueueQuery = `
+        INSERT INTO %s (item, attributes, expires_at, codec, enqueued_at) VALUES (?, ?, ?, ?, ?)
+    `
+)
+
+type attributeEnqueuer interface {
+	EnqueueWithAttributes(ctx context.Context, item []byte, attributes map[string]string) error
+}
+
+// EnqueueWithAttributes adds an item to the queue together with attributes,
+// such as a content type, trace ID or tenant ID. The attributes are returned
+// in Msg.Attributes when the item is dequeued.
+// It returns an error if the operation fails or the context is cancelled.
+func (q *Queue) EnqueueWithAttributes(ctx context.Context, item []byte, attributes map[string]string) error {
+	return retryWhileLocked(ctx, defaultPollInterval, func(ctx context.Context) error {
+		return q.TryEnqueueWithAttributes(ctx, item, attributes)
+	})
+}
+
+// TryEnqueueWithAttributes attempts to add an item to the queue together with attributes.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryEnqueueWithAttributes(ctx context.Context, item []byte, attributes map[string]string) error {
+	if q.queries.enqueueAttributes == "" {
+		return &ErrUnsupported{Op: "EnqueueWithAttributes"}
+	}
+	encoded, err := encodeAttributes(attributes)
+	if err != nil {
+		return err
+	}
+	return q.tryEnqueue(ctx, q.queries.enqueueAttributes, item, encoded, q.expiresAt(q.opts.TTL))
+}
+
+// encodeAttributes encodes attributes as a JSON object, or NULL if there are none.
+func encodeAttributes(attributes map[string]string) (sql.NullString, error) {
+	if len(attributes) == 0 {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode attributes: %w", err)
+	}
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
+
+func decodeAttributes(encoded sql.NullString) (map[string]string, error) {
+	if !encoded.Valid || encoded.String == "" {
+		return nil, nil
+	}
+	var attributes map[string]string
+	if err := json.Unmarshal([]byte(encoded.String), &attributes); err != nil {
+		return nil, fmt.Errorf("failed to decode attributes: %w", err)
+	}
+	return attributes, nil
+}
@@ -0,0 +1,81 @@
+package gopq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestQueue_EnqueueWithAttributes(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+	attributes := map[string]string{"content-type": "application/json", "trace-id": "abc"}
+
+	require.NoError(t, q.EnqueueWithAttributes(ctx, []byte("with"), attributes))
+	require.NoError(t, q.Enqueue([]byte("without")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "with", string(msg.Item))
+	assert.Equal(t, attributes, msg.Attributes)
+
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "without", string(msg.Item))
+	assert.Nil(t, msg.Attributes)
+}
+
+func TestUniqueQueue_EnqueueWithAttributes(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueWithAttributes(ctx, []byte("item"), map[string]string{"tenant": "a"}))
+
+	msgs, err := q.TryDequeueBatch(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "a", msgs[0].Attributes["tenant"])
+}
+
+func TestAckQueue_EnqueueWithAttributes(t *testing.T) {
+	q := setupDefaultTestAckQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueWithAttributes(ctx, []byte("item"), map[string]string{"tenant": "a"}))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a", msg.Attributes["tenant"])
+}
+
+func TestAckQueue_AttributesReachDeadLetterQueue(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, MaxRetries: 0})
+	dlq := setupTestQueue(t)
+	q.RegisterDeadLetterQueue(dlq)
+
+	var failed gopq.Msg
+	q.RegisterOnFailureCallback(func(msg gopq.Msg) error {
+		failed = msg
+		return nil
+	})
+
+	ctx := context.Background()
+	attributes := map[string]string{"trace-id": "abc"}
+	require.NoError(t, q.EnqueueWithAttributes(ctx, []byte("poison"), attributes))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.Nack(msg.ID))
+
+	assert.Equal(t, attributes, failed.Attributes)
+
+	dead, err := dlq.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "poison", string(dead.Item))
+	assert.Equal(t, "abc", dead.Attributes["trace-id"])
+}
@@ -0,0 +1,81 @@
+package gopq
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffPolicy determines how long a negatively acknowledged message waits
+// before it is delivered again. retry is the number of the upcoming retry,
+// starting at 1 for the first one.
+type BackoffPolicy interface {
+	Backoff(retry int) time.Duration
+}
+
+// ExponentialBackoff doubles the delay with every retry, starting at Base.
+// If Max is set, the delay never exceeds it.
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Backoff returns Base * 2^(retry-1), capped at Max.
+func (b ExponentialBackoff) Backoff(retry int) time.Duration {
+	d := b.Base
+	for i := 1; i < retry && d <= math.MaxInt64/2; i++ {
+		if b.Max > 0 && d >= b.Max {
+			break
+		}
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		return b.Max
+	}
+	return d
+}
+
+// ExponentialJitterBackoff is an ExponentialBackoff that spreads the retries
+// of messages failing at the same time. Each delay is picked at random between
+// half and the full exponential delay.
+type ExponentialJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Backoff returns a random delay between half and the full exponential delay.
+func (b ExponentialJitterBackoff) Backoff(retry int) time.Duration {
+	d := ExponentialBackoff(b).Backoff(retry)
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// ScheduleBackoff uses an explicit delay for every retry. Retries beyond the
+// end of the schedule use its last delay.
+type ScheduleBackoff []time.Duration
+
+// Backoff returns the delay scheduled for retry.
+func (b ScheduleBackoff) Backoff(retry int) time.Duration {
+	if len(b) == 0 {
+		return 0
+	}
+	if retry < 1 {
+		retry = 1
+	}
+	if retry > len(b) {
+		retry = len(b)
+	}
+	return b[retry-1]
+}
+
+// retryDelay returns how long a message waits before its retry. Without a
+// BackoffPolicy, the larger of RetryBackoff and AckTimeout is used.
+func (opts AckOpts) retryDelay(retry int) time.Duration {
+	if opts.BackoffPolicy != nil {
+		return opts.BackoffPolicy.Backoff(retry)
+	}
+	return max(opts.RetryBackoff, opts.AckTimeout)
+}
@@ -0,0 +1,76 @@
+package gopq_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := gopq.ExponentialBackoff{Base: time.Second, Max: 10 * time.Second}
+
+	assert.Equal(t, time.Second, b.Backoff(1))
+	assert.Equal(t, 2*time.Second, b.Backoff(2))
+	assert.Equal(t, 8*time.Second, b.Backoff(4))
+	assert.Equal(t, 10*time.Second, b.Backoff(5))
+	assert.Equal(t, 10*time.Second, b.Backoff(1000))
+
+	unbounded := gopq.ExponentialBackoff{Base: time.Second}
+	assert.Positive(t, unbounded.Backoff(1000))
+}
+
+func TestExponentialJitterBackoff(t *testing.T) {
+	b := gopq.ExponentialJitterBackoff{Base: time.Second, Max: time.Minute}
+
+	for retry := 1; retry <= 10; retry++ {
+		full := gopq.ExponentialBackoff(b).Backoff(retry)
+		for i := 0; i < 20; i++ {
+			d := b.Backoff(retry)
+			assert.GreaterOrEqual(t, d, full/2)
+			assert.LessOrEqual(t, d, full)
+		}
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	b := gopq.ScheduleBackoff{time.Second, time.Minute, time.Hour}
+
+	assert.Equal(t, time.Second, b.Backoff(1))
+	assert.Equal(t, time.Minute, b.Backoff(2))
+	assert.Equal(t, time.Hour, b.Backoff(3))
+	assert.Equal(t, time.Hour, b.Backoff(4))
+	assert.Equal(t, time.Duration(0), gopq.ScheduleBackoff{}.Backoff(1))
+}
+
+func TestAckQueue_BackoffPolicy(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout:    time.Minute,
+		MaxRetries:    gopq.InfiniteRetries,
+		BackoffPolicy: gopq.ScheduleBackoff{0, time.Hour},
+		CommonOpts: gopq.CommonOpts{
+			Clock: clock,
+		},
+	})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.Nack(msg.ID))
+
+	// The first retry is scheduled immediately rather than after AckTimeout.
+	clock.Advance(time.Millisecond)
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, msg.RetryCount)
+
+	// The second retry waits for an hour.
+	require.NoError(t, q.Nack(msg.ID))
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+}
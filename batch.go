@@ -0,0 +1,274 @@
+package gopq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EnqueueBatch adds all items to the queue in a single transaction.
+// It returns the IDs of the new messages in the order of items. Items a
+// unique queue ignored as duplicates get the ID 0.
+// Either all items are added or none are.
+// It returns an error if the operation fails or the context is cancelled.
+func (q *Queue) EnqueueBatch(ctx context.Context, items [][]byte) ([]int64, error) {
+	var ids []int64
+	err := retryWhileLocked(ctx, defaultPollInterval, func(ctx context.Context) error {
+		var err error
+		ids, err = q.TryEnqueueBatch(ctx, items)
+		return err
+	})
+	return ids, err
+}
+
+// TryEnqueueBatch attempts to add all items to the queue in a single transaction.
+// External queues return ErrUnsupported, as their procedures do not report
+// the IDs of the items they add.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryEnqueueBatch(ctx context.Context, items [][]byte) ([]int64, error) {
+	if q.queries.enqueue == "" || q.mode.is(modeExternal) {
+		return nil, &ErrUnsupported{Op: "EnqueueBatch"}
+	}
+	ids := make([]int64, len(items))
+	if len(items) == 0 {
+		return ids, nil
+	}
+
+	if err := q.purgeExpiredFirst(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, handleEnqueueResult(err)
+	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, q.queries.enqueue)
+	if err != nil {
+		return nil, handleEnqueueResult(err)
+	}
+	defer stmt.Close()
+
+	err = q.purgeExpiredTx(ctx, tx)
+	if err != nil {
+		return nil, handleEnqueueResult(err)
+	}
+
+	expiresAt := q.expiresAt(q.opts.TTL)
+	for i, item := range items {
+		args, err := q.enqueueArgs(item, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return nil, handleEnqueueResult(err)
+		}
+
+		// Duplicates in unique queues are ignored without an error.
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			continue
+		}
+
+		ids[i], err = res.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message id: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, handleEnqueueResult(err)
+	}
+
+	q.notify()
+	return ids, nil
+}
+
+// DequeueBatch removes and returns up to n items from the queue.
+// It blocks until at least one item is available or the context is
+// cancelled. It then keeps collecting items until it holds n of them or
+// wait has passed since the first item was claimed. A wait of zero returns
+// whatever is available as soon as there is at least one item.
+// The messages are returned in dequeue order. If an error occurs after some items
+// were claimed, they are returned together with the error.
+func (q *Queue) DequeueBatch(ctx context.Context, n int, wait time.Duration) ([]Msg, error) {
+	return dequeueBatchBlocking(ctx, q, q.TryDequeueBatch, n, wait, q.pollInterval, q.notifyChan)
+}
+
+// TryDequeueBatch attempts to remove and return up to n items from the queue
+// in a single statement.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryDequeueBatch(ctx context.Context, n int) ([]Msg, error) {
+	if q.queries.tryDequeueBatch == "" {
+		return nil, &ErrUnsupported{Op: "DequeueBatch"}
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("batch size must be positive: %d", n)
+	}
+	rows, err := q.db.QueryContext(ctx, q.queries.tryDequeueBatch, q.now(), n)
+	return q.handleDequeueBatchResult(rows, err)
+}
+
+// DequeueBatch removes and returns up to n items from the queue.
+// All items of the batch share one ack deadline, set when the first
+// item is claimed.
+// It blocks until at least one item is available or the context is
+// cancelled. It then keeps collecting items until it holds n of them or
+// wait has passed since the first item was claimed.
+func (q *AcknowledgeableQueue) DequeueBatch(ctx context.Context, n int, wait time.Duration) ([]Msg, error) {
+	var ackDeadline int64
+	claimed := 0
+	claim := func(ctx context.Context, remaining int) ([]Msg, error) {
+		if claimed == 0 {
+			ackDeadline = q.opts.Clock.Now().Add(q.AckOpts.AckTimeout).UnixMilli()
+		}
+		msgs, err := q.tryDequeueBatch(ctx, remaining, ackDeadline)
+		claimed += len(msgs)
+		return msgs, err
+	}
+	return dequeueBatchBlocking(ctx, q, claim, n, wait, q.pollInterval, q.notifyChan)
+}
+
+// TryDequeueBatch attempts to remove and return up to n items from the queue
+// in a single statement. All items of the batch share one ack deadline.
+// This is non-blocking, and will return immediately.
+func (q *AcknowledgeableQueue) TryDequeueBatch(ctx context.Context, n int) ([]Msg, error) {
+	return q.tryDequeueBatch(ctx, n, q.opts.Clock.Now().Add(q.AckOpts.AckTimeout).UnixMilli())
+}
+
+func (q *AcknowledgeableQueue) tryDequeueBatch(ctx context.Context, n int, ackDeadline int64) ([]Msg, error) {
+	if q.queries.tryDequeueBatch == "" {
+		return nil, &ErrUnsupported{Op: "DequeueBatch"}
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("batch size must be positive: %d", n)
+	}
+	rows, err := q.db.QueryContext(ctx, q.queries.tryDequeueBatch, q.now(), ackDeadline, n)
+	return q.handleDequeueBatchResult(rows, err)
+}
+
+// AckResult reports the outcome of acknowledging a single message of a batch.
+type AckResult struct {
+	ID int64
+
+	// Err is nil if the message was acknowledged. It is an
+	// *ErrAckDeadlineExpired if the ack deadline had already passed, and an
+	// *ErrMessageNotFound if the message does not exist.
+	Err error
+}
+
+// AckBatch acknowledges all given messages in a single transaction.
+// It returns one result per ID, in the order of ids. The returned error is
+// only set if the batch as a whole failed.
+// If the db is locked, this will block until the db is unlocked.
+func (q *AcknowledgeableQueue) AckBatch(ctx context.Context, ids []int64) ([]AckResult, error) {
+	var results []AckResult
+	err := retryWhileLocked(ctx, q.pollInterval, func(ctx context.Context) error {
+		var err error
+		results, err = q.TryAckBatch(ctx, ids)
+		return err
+	})
+	return results, err
+}
+
+// TryAckBatch acknowledges all given messages in a single transaction.
+// This is non-blocking, and will return immediately.
+func (q *AcknowledgeableQueue) TryAckBatch(ctx context.Context, ids []int64) ([]AckResult, error) {
+	results := make([]AckResult, len(ids))
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, handleLockedResult(err)
+	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
+
+	now := q.now()
+	for i, id := range ids {
+		results[i].ID = id
+		err := q.ackQueries.ackTx(ctx, tx, id, now)
+		if isMessageError(err) {
+			results[i].Err = err
+			continue
+		}
+		if err != nil {
+			return nil, handleLockedResult(err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, handleLockedResult(err)
+	}
+	return results, nil
+}
+
+// NackBatch negatively acknowledges all given messages in a single
+// transaction. Messages that have exhausted their retries are removed and
+// handed to the failure callbacks once the transaction is committed.
+// It returns one result per ID, in the order of ids. The returned error is
+// only set if the batch as a whole failed.
+// If the db is locked, this will block until the db is unlocked.
+func (q *AcknowledgeableQueue) NackBatch(ctx context.Context, ids []int64) ([]AckResult, error) {
+	var results []AckResult
+	err := retryWhileLocked(ctx, q.pollInterval, func(ctx context.Context) error {
+		var err error
+		results, err = q.TryNackBatch(ctx, ids)
+		return err
+	})
+	return results, err
+}
+
+// TryNackBatch negatively acknowledges all given messages in a single transaction.
+// This is non-blocking, and will return immediately.
+func (q *AcknowledgeableQueue) TryNackBatch(ctx context.Context, ids []int64) ([]AckResult, error) {
+	results := make([]AckResult, len(ids))
+	failed := make([]*DeadLetter, len(ids))
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, handleLockedResult(err)
+	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
+
+	now := q.opts.Clock.Now()
+	for i, id := range ids {
+		results[i].ID = id
+		dl, err := q.nackTx(ctx, tx, id, now, q.AckOpts.retryDelay, "")
+		if isMessageError(err) {
+			results[i].Err = err
+			continue
+		}
+		if err != nil {
+			return nil, handleLockedResult(err)
+		}
+		failed[i] = dl
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, handleLockedResult(err)
+	}
+
+	for i, dl := range failed {
+		if dl != nil {
+			results[i].Err = runFailureCallbacks(q.AckOpts, *dl)
+		}
+	}
+	return results, nil
+}
+
+// isMessageError reports whether err concerns a single message rather than
+// the batch it is part of.
+func isMessageError(err error) bool {
+	var expired *ErrAckDeadlineExpired
+	var notFound *ErrMessageNotFound
+	return errors.As(err, &expired) || errors.As(err, &notFound)
+}
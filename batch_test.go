@@ -0,0 +1,280 @@
+package gopq_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestQueue_EnqueueBatch(t *testing.T) {
+	q := setupTestQueue(t)
+
+	items := make([][]byte, 100)
+	for i := range items {
+		items[i] = []byte(fmt.Sprintf("item-%d", i))
+	}
+
+	ids, err := q.EnqueueBatch(context.Background(), items)
+	require.NoError(t, err)
+	require.Len(t, ids, len(items))
+	for i := 1; i < len(ids); i++ {
+		assert.Greater(t, ids[i], ids[i-1])
+	}
+
+	count, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, len(items), count)
+
+	for i := range items {
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, ids[i], msg.ID)
+		assert.Equal(t, items[i], msg.Item)
+	}
+}
+
+func TestQueue_EnqueueBatchEmpty(t *testing.T) {
+	q := setupTestQueue(t)
+
+	ids, err := q.TryEnqueueBatch(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestUniqueQueue_EnqueueBatchDuplicates(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+
+	ids, err := q.EnqueueBatch(context.Background(), [][]byte{
+		[]byte("a"), []byte("b"), []byte("a"),
+	})
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+	assert.NotZero(t, ids[0])
+	assert.NotZero(t, ids[1])
+	assert.Zero(t, ids[2])
+
+	count, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestAckQueue_EnqueueBatch(t *testing.T) {
+	q := setupDefaultTestAckQueue(t)
+
+	ids, err := q.EnqueueBatch(context.Background(), [][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+	assertLen(t, q, 2)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, ids[0], msg.ID)
+	require.NoError(t, q.Ack(msg.ID))
+	assertLen(t, q, 1)
+}
+
+func TestUniqueAckQueue_EnqueueBatch(t *testing.T) {
+	q := setupDefaultTestUniqueAckQueue(t)
+
+	_, err := q.EnqueueBatch(context.Background(), [][]byte{[]byte("a"), []byte("a"), []byte("b")})
+	require.NoError(t, err)
+	assertLen(t, q, 2)
+}
+
+func TestQueue_DequeueBatch(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	ids, err := q.EnqueueBatch(ctx, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	require.NoError(t, err)
+
+	msgs, err := q.DequeueBatch(ctx, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, ids[0], msgs[0].ID)
+	assert.Equal(t, ids[1], msgs[1].ID)
+
+	msgs, err = q.DequeueBatch(ctx, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "c", string(msgs[0].Item))
+
+	_, err = q.TryDequeueBatch(ctx, 2)
+	assert.Error(t, err)
+}
+
+func TestQueue_DequeueBatchWaitsForWindow(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, q.Enqueue([]byte("first")))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = q.Enqueue([]byte("second"))
+	}()
+
+	msgs, err := q.DequeueBatch(ctx, 10, 500*time.Millisecond)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 2)
+}
+
+func TestQueue_DequeueBatchBlocksUntilAvailable(t *testing.T) {
+	q := setupTestQueue(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := q.DequeueBatch(ctx, 10, time.Second)
+	assert.Error(t, err)
+
+	_, err = q.DequeueBatch(context.Background(), 0, 0)
+	assert.Error(t, err)
+}
+
+func TestUniqueQueue_DequeueBatch(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+	ctx := context.Background()
+
+	_, err := q.EnqueueBatch(ctx, [][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+
+	msgs, err := q.DequeueBatch(ctx, 5, 0)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 2)
+
+	// Dequeued items may be enqueued again.
+	require.NoError(t, q.Enqueue([]byte("a")))
+	count, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestAckQueue_DequeueBatch(t *testing.T) {
+	q := setupDefaultTestAckQueue(t)
+	ctx := context.Background()
+
+	_, err := q.EnqueueBatch(ctx, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	require.NoError(t, err)
+
+	msgs, err := q.DequeueBatch(ctx, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assertLen(t, q, 1)
+
+	// Unacked messages are redelivered once their deadline expires.
+	require.NoError(t, q.Ack(msgs[0].ID))
+	require.NoError(t, q.ExpireAck(msgs[1].ID))
+
+	msgs, err = q.DequeueBatch(ctx, 5, 0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "b", string(msgs[0].Item))
+	assert.Equal(t, "c", string(msgs[1].Item))
+}
+
+func TestUniqueAckQueue_DequeueBatch(t *testing.T) {
+	q := setupDefaultTestUniqueAckQueue(t)
+	ctx := context.Background()
+
+	_, err := q.EnqueueBatch(ctx, [][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+
+	msgs, err := q.TryDequeueBatch(ctx, 5)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	for _, msg := range msgs {
+		require.NoError(t, q.Ack(msg.ID))
+	}
+	assertLen(t, q, 0)
+}
+
+func TestAckQueue_AckBatch(t *testing.T) {
+	q := setupDefaultTestAckQueue(t)
+	ctx := context.Background()
+
+	_, err := q.EnqueueBatch(ctx, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	require.NoError(t, err)
+	msgs, err := q.TryDequeueBatch(ctx, 3)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+
+	require.NoError(t, q.ExpireAck(msgs[1].ID))
+
+	results, err := q.AckBatch(ctx, []int64{msgs[0].ID, msgs[1].ID, msgs[2].ID, 12345})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	assert.NoError(t, results[0].Err)
+	var expired *gopq.ErrAckDeadlineExpired
+	assert.ErrorAs(t, results[1].Err, &expired)
+	assert.NoError(t, results[2].Err)
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, results[3].Err, &notFound)
+	assert.Equal(t, int64(12345), results[3].ID)
+
+	// Only the expired message is left.
+	assertLen(t, q, 1)
+}
+
+func TestAckQueue_NackBatch(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout:   time.Hour,
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	})
+	dlq := setupTestQueue(t)
+	q.RegisterDeadLetterQueue(dlq)
+	ctx := context.Background()
+
+	_, err := q.EnqueueBatch(ctx, [][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+	msgs, err := q.TryDequeueBatch(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	ids := []int64{msgs[0].ID, msgs[1].ID}
+
+	// First nack schedules a retry.
+	results, err := q.NackBatch(ctx, ids)
+	require.NoError(t, err)
+	for _, r := range results {
+		assert.NoError(t, r.Err)
+	}
+
+	// Second nack exceeds MaxRetries and dead-letters both messages.
+	results, err = q.NackBatch(ctx, ids)
+	require.NoError(t, err)
+	for _, r := range results {
+		assert.NoError(t, r.Err)
+	}
+
+	assertLen(t, q, 0)
+	count, err := dlq.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	results, err = q.NackBatch(ctx, ids)
+	require.NoError(t, err)
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, results[0].Err, &notFound)
+}
+
+func TestAckQueue_NackBatchExpired(t *testing.T) {
+	q := setupDefaultTestAckQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("a")))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.ExpireAck(msg.ID))
+
+	results, err := q.TryNackBatch(ctx, []int64{msg.ID})
+	require.NoError(t, err)
+	var expired *gopq.ErrAckDeadlineExpired
+	assert.ErrorAs(t, results[0].Err, &expired)
+	assertLen(t, q, 1)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -12,6 +14,11 @@ type tryDequeuer interface {
 	TryDequeueCtx(ctx context.Context) (Msg, error)
 }
 
+// scheduler is implemented by queues that support delayed delivery.
+type scheduler interface {
+	untilVisible(ctx context.Context) (time.Duration, bool)
+}
+
 type ErrNoItemsWaiting struct{}
 
 func (e *ErrNoItemsWaiting) Error() string {
@@ -24,21 +31,104 @@ func (e *ErrDBLocked) Error() string {
 	return "database table is locked"
 }
 
+// ErrAckDeadlineExpired is returned when a message is acknowledged after its
+// ack deadline has passed. The message has been or will be redelivered.
+type ErrAckDeadlineExpired struct {
+	ID int64
+}
+
+func (e *ErrAckDeadlineExpired) Error() string {
+	return fmt.Sprintf("ack deadline of message %d has expired", e.ID)
+}
+
+// ErrMessageNotFound is returned when a message does not exist in the queue.
+type ErrMessageNotFound struct {
+	ID int64
+}
+
+func (e *ErrMessageNotFound) Error() string {
+	return fmt.Sprintf("message %d not found", e.ID)
+}
+
+// ErrUnsupported is returned when an operation is not supported by the
+// kind of queue it was called on.
+type ErrUnsupported struct {
+	Op string
+}
+
+func (e *ErrUnsupported) Error() string {
+	return e.Op + " is not supported by this queue"
+}
+
 // A helper function to handle common dequeue errors.
-func handleDequeueResult(id int64, item []byte, err error) (Msg, error) {
-	if err == sql.ErrNoRows {
+func (q *Queue) handleDequeueResult(rows *sql.Rows, err error) (Msg, error) {
+	// On error on cancelled context
+	if err != nil {
+		return Msg{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return Msg{}, err
+		}
 		return Msg{}, &ErrNoItemsWaiting{}
 	}
 
-	// On error on cancelled context
+	return q.scanMsg(rows)
+}
+
+// scanMsg reads a message from the current row. The row holds the id, the
+// item, the attributes, the enqueue time, the retry count, the ack deadline
+// and the codec of the item, with NULL for the columns a queue does not
+// have. Rows returned by external procedures have no codec and may omit
+// trailing columns after the item. Times are in Unix milliseconds. Columns
+// before the id are read into lead.
+func (q *Queue) scanMsg(rows *sql.Rows, lead ...any) (Msg, error) {
+	var msg Msg
+	var attributes sql.NullString
+	var codec sql.NullString
+	var enqueuedAt, retryCount, ackDeadline sql.NullInt64
+	dest := append(lead, &msg.ID, &msg.Item, &attributes, &enqueuedAt, &retryCount, &ackDeadline)
+	var err error
+	if q.mode.is(modeExternal) {
+		err = scanOptional(rows, dest...)
+	} else {
+		err = rows.Scan(append(dest, &codec)...)
+	}
+	if err != nil {
+		return Msg{}, err
+	}
+	msg.Item, err = decompress(msg.Item, codec)
+	if err != nil {
+		return Msg{}, err
+	}
+	msg.Attributes, err = decodeAttributes(attributes)
 	if err != nil {
 		return Msg{}, err
 	}
+	msg.RetryCount = int(retryCount.Int64)
+	if enqueuedAt.Valid {
+		msg.EnqueuedAt = time.UnixMilli(enqueuedAt.Int64)
+	}
+	if ackDeadline.Valid {
+		msg.AckDeadline = time.UnixMilli(ackDeadline.Int64)
+	}
+	return msg, nil
+}
 
-	return Msg{
-		ID:   id,
-		Item: item,
-	}, nil
+// scanOptional scans the current row into the leading entries of dest.
+// Destinations for columns the row does not have are left untouched, so
+// external procedures may omit trailing columns.
+func scanOptional(rows *sql.Rows, dest ...any) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(columns) < len(dest) {
+		dest = dest[:len(columns)]
+	}
+	return rows.Scan(dest...)
 }
 
 // dequeueBlocking blocks until an item is available to dequeue, or the context is cancelled.
@@ -58,13 +148,122 @@ func dequeueBlocking(ctx context.Context, dequeuer tryDequeuer, pollInterval tim
 		case <-ctx.Done():
 			return Msg{}, context.Canceled
 
-		case <-time.After(pollInterval): // Continue
+		case <-time.After(pollWait(ctx, dequeuer, pollInterval)): // Continue
 		case <-notifyChan: // Continue
 
 		}
 	}
 }
 
+// pollWait returns how long to wait before polling the queue again after a
+// dequeue came back empty. It wakes up when the earliest scheduled item
+// becomes visible, if that happens before the next poll. The time until then
+// is read from the queue's Clock, but waited for in real time, so advancing
+// a fake clock does not wake up a waiting dequeue before its next poll.
+func pollWait(ctx context.Context, dequeuer any, pollInterval time.Duration) time.Duration {
+	if s, ok := dequeuer.(scheduler); ok {
+		if untilVisible, ok := s.untilVisible(ctx); ok && untilVisible < pollInterval {
+			return untilVisible
+		}
+	}
+	return pollInterval
+}
+
+// A helper function to collect the messages claimed by a batch dequeue.
+// Batch queries return the position of each message in dequeue order before
+// its id, since the order of returned rows is not defined.
+func (q *Queue) handleDequeueBatchResult(rows *sql.Rows, err error) ([]Msg, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []Msg
+	var positions []int64
+	for rows.Next() {
+		var position int64
+		msg, err := q.scanMsg(rows, &position)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+		positions = append(positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(msgs) == 0 {
+		return nil, &ErrNoItemsWaiting{}
+	}
+
+	sort.Sort(byPosition{msgs, positions})
+	return msgs, nil
+}
+
+// byPosition sorts messages by their position in dequeue order.
+type byPosition struct {
+	msgs      []Msg
+	positions []int64
+}
+
+func (b byPosition) Len() int           { return len(b.msgs) }
+func (b byPosition) Less(i, j int) bool { return b.positions[i] < b.positions[j] }
+func (b byPosition) Swap(i, j int) {
+	b.msgs[i], b.msgs[j] = b.msgs[j], b.msgs[i]
+	b.positions[i], b.positions[j] = b.positions[j], b.positions[i]
+}
+
+// dequeueBatchBlocking claims messages until it holds n of them, or until
+// wait has passed since the first message was claimed.
+// It blocks until at least one message is available, or the context is cancelled.
+func dequeueBatchBlocking(ctx context.Context, dequeuer any, claim func(ctx context.Context, remaining int) ([]Msg, error), n int, wait time.Duration, pollInterval time.Duration, notifyChan chan struct{}) ([]Msg, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("batch size must be positive: %d", n)
+	}
+
+	var batch []Msg
+	var windowClosed <-chan time.Time // nil until the first message is claimed
+	for {
+		msgs, err := claim(ctx, n-len(batch))
+		if _, ok := err.(*ErrNoItemsWaiting); err != nil && !ok {
+			return batch, err
+		}
+
+		batch = append(batch, msgs...)
+		if len(batch) >= n {
+			return batch, nil
+		}
+
+		if len(batch) > 0 && windowClosed == nil {
+			if wait <= 0 {
+				return batch, nil
+			}
+			windowClosed = time.After(wait)
+		}
+
+		// Scheduled items only matter once the visible ones are used up.
+		next := pollInterval
+		if len(msgs) == 0 {
+			next = pollWait(ctx, dequeuer, pollInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			// Claimed messages must not get lost.
+			if len(batch) > 0 {
+				return batch, nil
+			}
+			return nil, context.Canceled
+
+		case <-windowClosed:
+			return batch, nil
+		case <-time.After(next): // Continue
+		case <-notifyChan: // Continue
+		}
+	}
+}
+
 type tryEnqueuer interface {
 	TryEnqueueCtx(ctx context.Context, item []byte) error
 }
@@ -85,9 +284,26 @@ func handleEnqueueResult(err error) error {
 	return nil
 }
 
+// handleLockedResult converts a locked table error to ErrDBLocked,
+// so that blocking operations retry it.
+func handleLockedResult(err error) error {
+	if err != nil && strings.Contains(err.Error(), "database table is locked") {
+		return &ErrDBLocked{}
+	}
+	return err
+}
+
 func enqueueBlocking(ctx context.Context, enqueuer tryEnqueuer, item []byte, pollInterval time.Duration) error {
+	return retryWhileLocked(ctx, pollInterval, func(ctx context.Context) error {
+		return enqueuer.TryEnqueueCtx(ctx, item)
+	})
+}
+
+// retryWhileLocked calls try until it succeeds, fails with an error other
+// than ErrDBLocked, or the context is cancelled.
+func retryWhileLocked(ctx context.Context, pollInterval time.Duration, try func(ctx context.Context) error) error {
 	for {
-		err := enqueuer.TryEnqueueCtx(ctx, item)
+		err := try(ctx)
 		if err == nil {
 			return nil
 		}
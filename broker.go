@@ -0,0 +1,191 @@
+package gopq
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/mattdeak/gopq/internal"
+)
+
+var queueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Broker opens a single SQLite database and hands out any number of named
+// queues of any type stored in it. All queues share the broker's connection.
+// Queues opened with the same type and name use the same table and share
+// their notifications, so a blocking Dequeue on one of them wakes up as soon
+// as another one enqueues an item.
+type Broker struct {
+	db *sql.DB
+
+	// suffix keeps the table names of in-memory brokers apart, as all
+	// in-memory databases are shared.
+	suffix string
+
+	mu          sync.Mutex
+	notifyChans map[string]chan struct{}
+	notifiers   map[string]*topicNotifier
+}
+
+// NewBroker opens the database at filePath for use by named queues.
+// If filePath is empty, the queues will be created in memory.
+func NewBroker(filePath string) (*Broker, error) {
+	db, err := internal.InitializeDB(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create broker: %w", err)
+	}
+
+	b := &Broker{
+		db:          db,
+		notifyChans: map[string]chan struct{}{},
+		notifiers:   map[string]*topicNotifier{},
+	}
+	if filePath == "" {
+		b.suffix = internal.UniqueSuffix()
+	}
+	return b, nil
+}
+
+// Close closes the database connection shared by all queues of the broker.
+func (b *Broker) Close() error {
+	return b.db.Close()
+}
+
+// SimpleQueue returns the simple queue with the given name.
+// Names may contain letters, digits and underscores.
+func (b *Broker) SimpleQueue(name string, opts ...QueueOptions) (*Queue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create simple queue: %w", err)
+	}
+	tableName, notifyChan, err := b.table("simple_queue", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.share(newSimpleQueue(b.db, tableName, notifyChan, qo))
+}
+
+// UniqueQueue returns the unique queue with the given name.
+// Names may contain letters, digits and underscores.
+func (b *Broker) UniqueQueue(name string, opts ...QueueOptions) (*Queue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create unique queue: %w", err)
+	}
+	tableName, notifyChan, err := b.table("unique_queue", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.share(newUniqueQueue(b.db, tableName, notifyChan, qo))
+}
+
+// PriorityQueue returns the priority queue with the given name.
+// Names may contain letters, digits and underscores.
+func (b *Broker) PriorityQueue(name string, opts ...QueueOptions) (*Queue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create priority queue: %w", err)
+	}
+	tableName, notifyChan, err := b.table("priority_queue", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.share(newPriorityQueue(b.db, tableName, notifyChan, qo))
+}
+
+// AckQueue returns the ack queue with the given name.
+// Names may contain letters, digits and underscores.
+func (b *Broker) AckQueue(name string, opts AckOpts) (*AcknowledgeableQueue, error) {
+	tableName, notifyChan, err := b.table("ack_queue", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.shareAck(newAckQueue(b.db, tableName, notifyChan, opts))
+}
+
+// UniqueAckQueue returns the unique ack queue with the given name.
+// Names may contain letters, digits and underscores.
+func (b *Broker) UniqueAckQueue(name string, opts AckOpts) (*AcknowledgeableQueue, error) {
+	tableName, notifyChan, err := b.table("unique_ack_queue", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.shareAck(newUniqueAckQueue(b.db, tableName, notifyChan, opts))
+}
+
+// PriorityAckQueue returns the priority ack queue with the given name.
+// Names may contain letters, digits and underscores.
+func (b *Broker) PriorityAckQueue(name string, ackOpts AckOpts, opts ...QueueOptions) (*AcknowledgeableQueue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create priority ack queue: %w", err)
+	}
+	tableName, notifyChan, err := b.table("priority_ack_queue", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.shareAck(newPriorityAckQueue(b.db, tableName, notifyChan, ackOpts, qo))
+}
+
+// Topic returns the topic with the given name. See NewTopic for opts.
+// Names may contain letters, digits and underscores.
+func (b *Broker) Topic(name string, opts ...QueueOptions) (*Topic, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create topic: %w", err)
+	}
+	tableName, _, err := b.table("topic", name)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	notifier, ok := b.notifiers[tableName]
+	if !ok {
+		notifier = newTopicNotifier()
+		b.notifiers[tableName] = notifier
+	}
+	b.mu.Unlock()
+
+	t, err := newTopic(b.db, tableName, notifier, qo)
+	if err != nil {
+		return nil, err
+	}
+	t.shared = true
+	return t, nil
+}
+
+// table returns the table name and notification channel of a named queue.
+func (b *Broker) table(prefix string, name string) (string, chan struct{}, error) {
+	if !queueNamePattern.MatchString(name) {
+		return "", nil, fmt.Errorf("invalid queue name %q: only letters, digits and underscores are allowed", name)
+	}
+	tableName := prefix + "_" + name + b.suffix
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	notifyChan, ok := b.notifyChans[tableName]
+	if !ok {
+		notifyChan = internal.MakeNotifyChan()
+		b.notifyChans[tableName] = notifyChan
+	}
+	return tableName, notifyChan, nil
+}
+
+// share marks a queue as using the broker's connection.
+func (b *Broker) share(q *Queue, err error) (*Queue, error) {
+	if err != nil {
+		return nil, err
+	}
+	q.mode |= modeShared
+	return q, nil
+}
+
+func (b *Broker) shareAck(q *AcknowledgeableQueue, err error) (*AcknowledgeableQueue, error) {
+	if err != nil {
+		return nil, err
+	}
+	q.mode |= modeShared
+	return q, nil
+}
@@ -0,0 +1,133 @@
+package gopq_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func setupTestBroker(t *testing.T) (*gopq.Broker, string) {
+	tempFile := tempFilePath(t)
+	t.Cleanup(func() { os.Remove(tempFile) })
+
+	b, err := gopq.NewBroker(tempFile)
+	require.NoError(t, err)
+	t.Cleanup(func() { b.Close() })
+	return b, tempFile
+}
+
+func TestBroker_NamedQueuesAreIndependent(t *testing.T) {
+	b, _ := setupTestBroker(t)
+
+	emails, err := b.AckQueue("emails", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	jobs, err := b.AckQueue("jobs", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	logs, err := b.SimpleQueue("emails")
+	require.NoError(t, err)
+
+	require.NoError(t, emails.Enqueue([]byte("email")))
+	require.NoError(t, jobs.Enqueue([]byte("job")))
+
+	assertLen(t, emails, 1)
+	assertLen(t, jobs, 1)
+	length, err := logs.Len()
+	require.NoError(t, err)
+	assert.Zero(t, length)
+
+	msg, err := jobs.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "job", string(msg.Item))
+	require.NoError(t, jobs.Ack(msg.ID))
+	assertLen(t, emails, 1)
+}
+
+func TestBroker_SameNameSharesTable(t *testing.T) {
+	b, _ := setupTestBroker(t)
+
+	producer, err := b.SimpleQueue("tasks")
+	require.NoError(t, err)
+	consumer, err := b.SimpleQueue("tasks")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan gopq.Msg)
+	go func() {
+		msg, err := consumer.DequeueCtx(ctx)
+		assert.NoError(t, err)
+		done <- msg
+	}()
+
+	require.NoError(t, producer.Enqueue([]byte("task")))
+	msg := <-done
+	assert.Equal(t, "task", string(msg.Item))
+}
+
+func TestBroker_ClosingQueueKeepsBrokerOpen(t *testing.T) {
+	b, _ := setupTestBroker(t)
+
+	first, err := b.SimpleQueue("first")
+	require.NoError(t, err)
+	second, err := b.SimpleQueue("second")
+	require.NoError(t, err)
+
+	require.NoError(t, first.Close())
+	assert.NoError(t, second.Enqueue([]byte("item")))
+}
+
+func TestBroker_Persistence(t *testing.T) {
+	b, tempFile := setupTestBroker(t)
+
+	q, err := b.UniqueAckQueue("jobs", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue([]byte("job")))
+	require.NoError(t, b.Close())
+
+	b, err = gopq.NewBroker(tempFile)
+	require.NoError(t, err)
+	defer b.Close()
+
+	q, err = b.UniqueAckQueue("jobs", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "job", string(msg.Item))
+}
+
+func TestBroker_InMemoryBrokersAreIndependent(t *testing.T) {
+	first, err := gopq.NewBroker("")
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := gopq.NewBroker("")
+	require.NoError(t, err)
+	defer second.Close()
+
+	q1, err := first.PriorityQueue("jobs")
+	require.NoError(t, err)
+	q2, err := second.PriorityQueue("jobs")
+	require.NoError(t, err)
+
+	require.NoError(t, q1.Enqueue([]byte("job")))
+	_, err = q2.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+}
+
+func TestBroker_InvalidName(t *testing.T) {
+	b, _ := setupTestBroker(t)
+
+	for _, name := range []string{"", "jobs; DROP TABLE x", "with space", "dash-ed"} {
+		_, err := b.SimpleQueue(name)
+		assert.Error(t, err, name)
+	}
+
+	_, err := b.PriorityAckQueue("jobs_2", gopq.AckOpts{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,85 @@
+package gopq
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	browseQuery = `
+        SELECT id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
+        FROM %[1]s WHERE %[2]s
+        ORDER BY %[3]s
+        LIMIT ?2 OFFSET ?3
+    `
+	browseAckQuery = `
+        SELECT id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
+        FROM %[1]s WHERE %[2]s
+        ORDER BY %[3]s
+        LIMIT ?2 OFFSET ?3
+    `
+
+	// Conditions selecting the items of each kind of queue that the next
+	// dequeue would consider.
+	readyCondition = `processed_at IS NULL AND (visible_at IS NULL OR visible_at <= ?1)
+            AND (expires_at IS NULL OR expires_at > ?1)`
+	uniqueReadyCondition = `(visible_at IS NULL OR visible_at <= ?1)
+            AND (expires_at IS NULL OR expires_at > ?1)`
+	ackReadyCondition = `processed_at IS NULL AND (ack_deadline IS NULL OR ack_deadline < ?1)
+            AND (visible_at IS NULL OR visible_at <= ?1)
+            AND (expires_at IS NULL OR expires_at > ?1)`
+	uniqueAckReadyCondition = `(ack_deadline IS NULL OR ack_deadline < ?1)
+            AND (visible_at IS NULL OR visible_at <= ?1)
+            AND (expires_at IS NULL OR expires_at > ?1)`
+
+	// Conditions selecting the pending items of each kind of queue: all
+	// items that have not been processed or expired, including delayed
+	// items and items waiting for an acknowledgement.
+	pendingCondition       = "processed_at IS NULL AND (expires_at IS NULL OR expires_at > ?1)"
+	uniquePendingCondition = "(expires_at IS NULL OR expires_at > ?1)"
+
+	fifoOrder = "enqueued_at ASC, id ASC"
+)
+
+// Peek returns the item the next dequeue would return, without removing it
+// or changing its state.
+// It returns ErrNoItemsWaiting if no item is ready to be dequeued.
+func (q *Queue) Peek(ctx context.Context) (Msg, error) {
+	if q.queries.peek == "" {
+		return Msg{}, &ErrUnsupported{Op: "Peek"}
+	}
+	rows, err := q.db.QueryContext(ctx, q.queries.peek, q.now(), 1, 0)
+	return q.handleDequeueResult(rows, err)
+}
+
+// Browse returns up to limit pending items, skipping the first offset of
+// them, in the order they would be dequeued. Pending items include delayed
+// items and items waiting for an acknowledgement; their AckDeadline tells
+// them apart. Browsing does not change the state of any item.
+func (q *Queue) Browse(ctx context.Context, offset int, limit int) ([]Msg, error) {
+	if q.queries.browse == "" {
+		return nil, &ErrUnsupported{Op: "Browse"}
+	}
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative: %d, %d", offset, limit)
+	}
+
+	rows, err := q.db.QueryContext(ctx, q.queries.browse, q.now(), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to browse queue: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []Msg
+	for rows.Next() {
+		msg, err := q.scanMsg(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to browse queue: %w", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to browse queue: %w", err)
+	}
+	return msgs, nil
+}
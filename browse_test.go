@@ -0,0 +1,125 @@
+package gopq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func items(msgs []gopq.Msg) []string {
+	var items []string
+	for _, msg := range msgs {
+		items = append(items, string(msg.Item))
+	}
+	return items
+}
+
+func TestQueue_PeekAndBrowse(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("a")))
+	require.NoError(t, q.Enqueue([]byte("b")))
+	require.NoError(t, q.Enqueue([]byte("c")))
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("later"), time.Hour))
+
+	msg, err := q.Peek(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Item))
+
+	msgs, err := q.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "later"}, items(msgs))
+
+	msgs, err = q.Browse(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, items(msgs))
+
+	_, err = q.Browse(ctx, -1, 2)
+	assert.Error(t, err)
+
+	// Nothing was consumed.
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Item))
+}
+
+func TestUniqueQueue_PeekKeepsItem(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+	ctx := context.Background()
+
+	_, err := q.Peek(ctx)
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	msg, err := q.Peek(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(msg.Item))
+
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(msg.Item))
+}
+
+func TestAckQueue_BrowseShowsInFlightItems(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute})
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("stuck")))
+	require.NoError(t, q.Enqueue([]byte("next")))
+
+	stuck, err := q.TryDequeue()
+	require.NoError(t, err)
+
+	msg, err := q.Peek(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "next", string(msg.Item))
+	assert.True(t, msg.AckDeadline.IsZero())
+
+	msgs, err := q.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stuck", "next"}, items(msgs))
+	assert.Equal(t, stuck.AckDeadline, msgs[0].AckDeadline)
+
+	require.NoError(t, q.Ack(stuck.ID))
+	msgs, err = q.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"next"}, items(msgs))
+}
+
+func TestPriorityQueue_BrowseInPriorityOrder(t *testing.T) {
+	q := setupTestPriorityQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("low"), 1))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("high"), 10))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("medium"), 5))
+
+	msgs, err := q.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"high", "medium", "low"}, items(msgs))
+}
+
+func TestTopic_GroupPeek(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+
+	group, err := topic.Subscribe("group", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	require.NoError(t, topic.Publish(ctx, []byte("first")))
+	require.NoError(t, topic.Publish(ctx, []byte("second")))
+
+	msg, err := group.Peek(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(msg.Item))
+
+	msgs, err := group.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, items(msgs))
+	assertLen(t, group, 2)
+}
@@ -0,0 +1,40 @@
+package gopq
+
+import "time"
+
+// Clock tells a queue the current time. It decides when ack deadlines, retry
+// backoffs, delayed delivery and time-to-live run out, and it stamps the
+// enqueue and processing times that priority aging and retention are based
+// on. Queues use the system clock unless one is set with WithClock or
+// AckOpts.Clock. The gopqtest package provides a clock that tests can advance
+// by hand.
+//
+// Work done in the background, such as KeepAlive renewals, the purging and
+// compaction at the retention interval and the wake-up of blocking dequeues
+// for scheduled items, is paced by real time. Tests that use a fake clock
+// call ExtendAck, PurgeExpired, Compact or TryDequeue directly.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock sets the clock a queue reads the current time from.
+func WithClock(clock Clock) QueueOptions {
+	return func(o *Opts) error {
+		o.Clock = clock
+		return nil
+	}
+}
+
+// queueClock returns the configured clock, or the system clock if none is set.
+func queueClock(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
@@ -0,0 +1,147 @@
+package gopq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
+)
+
+func TestClock_AckTimeout(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, CommonOpts: gopq.CommonOpts{Clock: clock}})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(time.Hour).UnixMilli(), msg.AckDeadline.UnixMilli())
+
+	clock.Advance(59 * time.Minute)
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+
+	clock.Advance(2 * time.Minute)
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(msg.Item))
+
+	var expired *gopq.ErrAckDeadlineExpired
+	clock.Advance(2 * time.Hour)
+	assert.ErrorAs(t, q.Nack(msg.ID), &expired)
+}
+
+func TestClock_RetryBackoff(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout:    time.Minute,
+		MaxRetries:    gopq.InfiniteRetries,
+		BackoffPolicy: gopq.ExponentialBackoff{Base: time.Hour},
+		CommonOpts: gopq.CommonOpts{
+			Clock: clock,
+		},
+	})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	for retry := 1; retry <= 3; retry++ {
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		require.NoError(t, q.Nack(msg.ID))
+
+		backoff := gopq.ExponentialBackoff{Base: time.Hour}.Backoff(retry)
+		clock.Advance(backoff - time.Second)
+		_, err = q.TryDequeue()
+		assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+		clock.Advance(2 * time.Second)
+	}
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, 3, msg.RetryCount)
+}
+
+func TestClock_DelayedDeliveryAndTTL(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q, err := gopq.NewSimpleQueue(tempFilePath(t), gopq.WithClock(clock))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("later"), time.Hour))
+	require.NoError(t, q.EnqueueWithTTL(ctx, []byte("expiring"), 30*time.Minute))
+	assertQueueLen(t, q, 1)
+
+	clock.Advance(time.Hour)
+	assertQueueLen(t, q, 1)
+	expired, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "later", string(msg.Item))
+}
+
+func TestClock_PriorityAging(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q, err := gopq.NewPriorityQueue(tempFilePath(t), gopq.WithPriorityAging(time.Minute), gopq.WithClock(clock))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("old"), 0))
+	clock.Advance(time.Hour)
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("new"), 1))
+
+	msgs := dequeueN(t, q, 2)
+	assert.Equal(t, []string{"old", "new"}, items(msgs))
+	assert.Equal(t, clock.Now().Add(-time.Hour).UnixMilli(), msgs[0].EnqueuedAt.UnixMilli())
+	assert.Equal(t, clock.Now().UnixMilli(), msgs[1].EnqueuedAt.UnixMilli())
+}
+
+func TestClock_Retention(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now().Add(-3 * time.Hour))
+	q, err := gopq.NewSimpleQueue(tempFilePath(t), gopq.WithRetention(gopq.RetentionPolicy{MaxAge: time.Hour}), gopq.WithClock(clock))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	dequeueN(t, q, 1)
+
+	deleted, err := q.Compact(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	clock.Advance(2 * time.Hour)
+	deleted, err = q.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
+
+func TestClock_TopicPublishTime(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now().Add(-time.Hour))
+	topic, err := gopq.NewTopic(tempFilePath(t), gopq.WithClock(clock))
+	require.NoError(t, err)
+	defer topic.Close()
+
+	group, err := topic.Subscribe("group", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	require.NoError(t, topic.Publish(context.Background(), []byte("item")))
+
+	msg, err := group.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().UnixMilli(), msg.EnqueuedAt.UnixMilli())
+	assert.Equal(t, clock.Now().Add(time.Minute).UnixMilli(), msg.AckDeadline.UnixMilli())
+}
+
+func assertQueueLen(t *testing.T, q *gopq.Queue, expected int) {
+	t.Helper()
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, expected, n)
+}
@@ -0,0 +1,141 @@
+package gopq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Compressor compresses items before they are stored and decompresses them
+// when they are read.
+type Compressor interface {
+	// Name identifies the compressor in the codec column of the items it
+	// compressed. It must not change once items have been stored.
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor compresses items with gzip at the given level. The zero
+// value uses gzip.DefaultCompression.
+type GzipCompressor struct {
+	// Level is a gzip compression level such as gzip.BestSpeed. Zero means
+	// gzip.DefaultCompression.
+	Level int
+
+	// NoCompression writes items with gzip.NoCompression, which the zero
+	// Level cannot select. Level is ignored when it is set.
+	NoCompression bool
+}
+
+func (c GzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	switch {
+	case c.NoCompression:
+		level = gzip.NoCompression
+	case level == 0:
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compressors are the compressors items can be read with, by name.
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		GzipCompressor{}.Name(): GzipCompressor{},
+	}
+)
+
+// RegisterCompressor makes items compressed by c readable by every queue,
+// including queues that do not compress new items themselves. Queues
+// register the compressor they are created with, and gzip is always
+// registered. It returns an error if a compressor of a different type is
+// already registered under the same name, since items stored by it could no
+// longer be read.
+func RegisterCompressor(c Compressor) error {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	name := c.Name()
+	if registered, ok := compressors[name]; ok {
+		if reflect.TypeOf(registered) != reflect.TypeOf(c) {
+			return fmt.Errorf("compressor %q is already registered by %T", name, registered)
+		}
+		return nil
+	}
+	compressors[name] = c
+	return nil
+}
+
+// WithCompression compresses the items of a queue with c when they are
+// stored. Items stored before, or by queues without compression, stay
+// readable. External queues ignore it.
+func WithCompression(c Compressor) QueueOptions {
+	return func(o *Opts) error {
+		o.Compression = c
+		return nil
+	}
+}
+
+// compress returns the stored form of item and the name of its compressor,
+// or nil if it is stored uncompressed. Items that do not get smaller are
+// stored uncompressed.
+func (q *Queue) compress(item []byte) ([]byte, any, error) {
+	if q.opts.Compression == nil {
+		return item, nil, nil
+	}
+	compressed, err := q.opts.Compression.Compress(item)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compress item: %w", err)
+	}
+	if len(compressed) >= len(item) {
+		return item, nil, nil
+	}
+	return compressed, q.opts.Compression.Name(), nil
+}
+
+// decompress returns the item stored with the given codec.
+func decompress(item []byte, codec sql.NullString) ([]byte, error) {
+	if !codec.Valid {
+		return item, nil
+	}
+	compressorsMu.RLock()
+	c, ok := compressors[codec.String]
+	compressorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no compressor registered for codec %q", codec.String)
+	}
+	data, err := c.Decompress(item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress item: %w", err)
+	}
+	return data, nil
+}
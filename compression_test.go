@@ -0,0 +1,224 @@
+package gopq_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+// prefixCompressor "compresses" items by dropping a known prefix.
+type prefixCompressor struct{}
+
+const compressedPrefix = "compressible:"
+
+func (prefixCompressor) Name() string { return "prefix" }
+
+func (prefixCompressor) Compress(data []byte) ([]byte, error) {
+	return bytes.TrimPrefix(data, []byte(compressedPrefix)), nil
+}
+
+func (prefixCompressor) Decompress(data []byte) ([]byte, error) {
+	return append([]byte(compressedPrefix), data...), nil
+}
+
+func TestQueue_GzipCompression(t *testing.T) {
+	path := tempFilePath(t)
+	document := []byte(`{"body":"` + strings.Repeat("lorem ipsum ", 10000) + `"}`)
+
+	// Rows stored before compression is turned on...
+	q, err := gopq.NewSimpleQueue(path)
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue([]byte("plain")))
+	require.NoError(t, q.Close())
+
+	q, err = gopq.NewSimpleQueue(path, gopq.WithCompression(gopq.GzipCompressor{}))
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(document))
+	require.NoError(t, q.Enqueue([]byte("tiny")))
+	require.NoError(t, q.Close())
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	rows, err := db.Query("SELECT length(item), codec FROM simple_queue ORDER BY id")
+	require.NoError(t, err)
+	var codecs []sql.NullString
+	var sizes []int
+	for rows.Next() {
+		var size int
+		var codec sql.NullString
+		require.NoError(t, rows.Scan(&size, &codec))
+		sizes = append(sizes, size)
+		codecs = append(codecs, codec)
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, codecs, 3)
+	assert.False(t, codecs[0].Valid)
+	assert.Equal(t, "gzip", codecs[1].String)
+	assert.Less(t, sizes[1], len(document)/10)
+	// Items that do not get smaller are stored as they are.
+	assert.False(t, codecs[2].Valid)
+
+	// ...and compressed rows are readable without the option.
+	q, err = gopq.NewSimpleQueue(path)
+	require.NoError(t, err)
+	defer q.Close()
+	msgs, err := q.Browse(context.Background(), 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"plain", string(document), "tiny"}, items(msgs))
+	for _, want := range []string{"plain", string(document), "tiny"} {
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(msg.Item))
+	}
+}
+
+func TestAckQueue_CustomCompressor(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		MaxRetries: 0,
+		CommonOpts: gopq.CommonOpts{
+			Compression: prefixCompressor{},
+		},
+	})
+	ctx := context.Background()
+
+	var dead []byte
+	q.RegisterOnDeadLetterCallback(func(dl gopq.DeadLetter) error {
+		dead = dl.Item
+		return nil
+	})
+
+	item := compressedPrefix + "payload"
+	require.NoError(t, q.Enqueue([]byte(item)))
+	_, err := q.EnqueueBatch(ctx, [][]byte{[]byte(item + "-1"), []byte(item + "-2")})
+	require.NoError(t, err)
+
+	msgs, err := q.TryDequeueBatch(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{item, item + "-1", item + "-2"}, items(msgs))
+
+	require.NoError(t, q.Nack(msgs[0].ID))
+	assert.Equal(t, item, string(dead))
+}
+
+func TestUniqueQueue_CompressionWithKeys(t *testing.T) {
+	q, err := gopq.NewUniqueQueue("", gopq.WithCompression(gopq.GzipCompressor{}))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	document := []byte(strings.Repeat("abc", 1000))
+	require.NoError(t, q.EnqueueWithKey(ctx, "doc", document))
+	require.NoError(t, q.EnqueueWithKey(ctx, "doc", slices.Concat(document, []byte("!"))))
+	require.NoError(t, q.Enqueue(document))
+	require.NoError(t, q.Enqueue(document))
+	assertQueueLen(t, q, 2)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, document, msg.Item)
+}
+
+func TestUniqueQueue_CompressionDedupesByContent(t *testing.T) {
+	path := tempFilePath(t)
+	document := []byte(strings.Repeat("abc", 1000))
+
+	q, err := gopq.NewUniqueQueue(path, gopq.WithCompression(gopq.GzipCompressor{}))
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(document))
+	require.NoError(t, q.Close())
+
+	// Another level stores the same content as different bytes.
+	q, err = gopq.NewUniqueQueue(path, gopq.WithCompression(gopq.GzipCompressor{Level: gzip.BestSpeed}))
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(document))
+	assertQueueLen(t, q, 1)
+	require.NoError(t, q.Close())
+
+	// Different content may be stored as the same bytes.
+	q, err = gopq.NewUniqueQueue("", gopq.WithCompression(prefixCompressor{}))
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.Enqueue([]byte(compressedPrefix+"x")))
+	require.NoError(t, q.Enqueue([]byte("x")))
+	require.NoError(t, q.Enqueue([]byte(compressedPrefix+"x")))
+	assertQueueLen(t, q, 2)
+}
+
+func TestUniqueAckQueue_CompressionWithKeyFunc(t *testing.T) {
+	q := setupTestUniqueAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		CommonOpts: gopq.CommonOpts{
+			Compression: gopq.GzipCompressor{},
+			KeyFunc:     func(item []byte) string { return string(item[:3]) },
+		},
+	})
+
+	document := []byte(strings.Repeat("abc", 1000))
+	require.NoError(t, q.Enqueue(document))
+	require.NoError(t, q.Enqueue(slices.Concat(document, []byte("!"))))
+	require.NoError(t, q.Enqueue([]byte("xyz")))
+	assertLen(t, q, 2)
+}
+
+func TestQueue_UnknownCodec(t *testing.T) {
+	path := tempFilePath(t)
+	q, err := gopq.NewSimpleQueue(path)
+	require.NoError(t, err)
+	defer q.Close()
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO simple_queue (item, codec, enqueued_at) VALUES (x'00', 'unknown', 0)")
+	require.NoError(t, err)
+
+	_, err = q.TryDequeue()
+	assert.ErrorContains(t, err, `no compressor registered for codec "unknown"`)
+}
+
+func TestGzipCompressor_Levels(t *testing.T) {
+	data := []byte(strings.Repeat("abc", 1000))
+
+	for _, c := range []gopq.GzipCompressor{{}, {Level: gzip.BestSpeed}, {NoCompression: true}} {
+		compressed, err := c.Compress(data)
+		require.NoError(t, err)
+		if c.NoCompression {
+			assert.Greater(t, len(compressed), len(data))
+		} else {
+			assert.Less(t, len(compressed), len(data)/10)
+		}
+		decompressed, err := c.Decompress(compressed)
+		require.NoError(t, err)
+		assert.Equal(t, data, decompressed)
+	}
+}
+
+// fakeGzipCompressor claims the name of the built-in gzip compressor.
+type fakeGzipCompressor struct{ prefixCompressor }
+
+func (fakeGzipCompressor) Name() string { return "gzip" }
+
+func TestRegisterCompressor_NameConflict(t *testing.T) {
+	require.NoError(t, gopq.RegisterCompressor(prefixCompressor{}))
+	require.NoError(t, gopq.RegisterCompressor(prefixCompressor{}))
+	require.NoError(t, gopq.RegisterCompressor(gopq.GzipCompressor{Level: gzip.BestSpeed}))
+
+	assert.ErrorContains(t, gopq.RegisterCompressor(fakeGzipCompressor{}), `compressor "gzip" is already registered`)
+
+	_, err := gopq.NewSimpleQueue("", gopq.WithCompression(fakeGzipCompressor{}))
+	assert.Error(t, err)
+	_, err = gopq.NewAckQueue("", gopq.AckOpts{CommonOpts: gopq.CommonOpts{Compression: fakeGzipCompressor{}}})
+	assert.Error(t, err)
+}
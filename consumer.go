@@ -0,0 +1,211 @@
+package gopq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// consumerErrorBackoff is how long a worker waits after a failed dequeue
+// before it tries again.
+const consumerErrorBackoff = time.Second
+
+// Handler processes a message dequeued by a Consumer. Returning nil
+// acknowledges the message, returning an error negatively acknowledges it.
+// Wrapping the error with RetryAfter sets the delay before its redelivery.
+type Handler func(ctx context.Context, msg Msg) error
+
+// ConsumerOpts represents the settings of a Consumer.
+type ConsumerOpts struct {
+	// Workers is the number of messages processed concurrently.
+	// It defaults to 1.
+	Workers int
+
+	// ShutdownTimeout bounds how long in-flight handlers may keep running
+	// once the context passed to Run is cancelled. When it has passed, the
+	// context of the handlers is cancelled. Zero waits for them indefinitely.
+	ShutdownTimeout time.Duration
+
+	// OnError is called with errors returned or raised by the handler, and
+	// with errors of the dequeue, ack and nack operations. Msg is empty for
+	// dequeue errors.
+	OnError func(msg Msg, err error)
+
+	// KeepAlive renews the lease of a message while its handler runs, so
+	// that handlers may take longer than the AckTimeout of the queue. The
+	// context of the handler is cancelled if the lease is lost.
+	KeepAlive bool
+}
+
+// ErrHandlerPanic is reported when a handler panics. The message is
+// negatively acknowledged.
+type ErrHandlerPanic struct {
+	Value any
+	Stack []byte
+}
+
+func (e *ErrHandlerPanic) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// ErrShutdownTimeout is returned by Run when the in-flight handlers had not
+// finished ShutdownTimeout after its context was cancelled, and their
+// context was cancelled as well.
+type ErrShutdownTimeout struct {
+	Timeout time.Duration
+}
+
+func (e *ErrShutdownTimeout) Error() string {
+	return fmt.Sprintf("handlers did not finish within the shutdown timeout of %v", e.Timeout)
+}
+
+// Consumer runs a pool of workers that dequeue messages from a queue and
+// pass them to a handler. A message is acknowledged if the handler returns
+// nil and negatively acknowledged if it returns an error or panics.
+type Consumer struct {
+	queue   AckableQueue
+	handler Handler
+	opts    ConsumerOpts
+}
+
+// NewConsumer creates a consumer that processes the messages of queue with handler.
+func NewConsumer(queue AckableQueue, handler Handler, opts ConsumerOpts) *Consumer {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	return &Consumer{
+		queue:   queue,
+		handler: handler,
+		opts:    opts,
+	}
+}
+
+// Run processes messages until ctx is cancelled. It then stops dequeueing,
+// waits for the in-flight handlers to finish and acknowledges their
+// messages before it returns. Handlers keep their context until
+// ShutdownTimeout has passed after ctx was cancelled. Run returns the error
+// of ctx, or an *ErrShutdownTimeout if the handlers had to be cancelled.
+func (c *Consumer) Run(ctx context.Context) error {
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	// The shutdown timer is stopped once the workers returned, so that it
+	// does not outlive a consumer whose handlers finished in time.
+	var timedOut atomic.Bool
+	done := make(chan struct{})
+	timerDone := make(chan struct{})
+	go func() {
+		defer close(timerDone)
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		if c.opts.ShutdownTimeout <= 0 {
+			return
+		}
+		timer := time.NewTimer(c.opts.ShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			timedOut.Store(true)
+			cancelHandlers()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(ctx, handlerCtx)
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-timerDone
+
+	if timedOut.Load() {
+		return &ErrShutdownTimeout{Timeout: c.opts.ShutdownTimeout}
+	}
+	return ctx.Err()
+}
+
+// work processes messages until ctx is cancelled.
+func (c *Consumer) work(ctx context.Context, handlerCtx context.Context) {
+	for {
+		msg, err := c.queue.DequeueCtx(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.reportError(Msg{}, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(consumerErrorBackoff):
+			}
+			continue
+		}
+
+		c.process(handlerCtx, msg)
+	}
+}
+
+// process hands a message to the handler and acknowledges it accordingly.
+func (c *Consumer) process(ctx context.Context, msg Msg) {
+	var err error
+	if lk, ok := c.queue.(leaseKeeper); ok && c.opts.KeepAlive {
+		err = lk.KeepAlive(ctx, msg.ID, func(ctx context.Context) error {
+			return c.handle(ctx, msg)
+		})
+	} else {
+		err = c.handle(ctx, msg)
+	}
+	if err == nil {
+		if err := c.queue.Ack(msg.ID); err != nil {
+			c.reportError(msg, err)
+		}
+		return
+	}
+
+	c.reportError(msg, err)
+	if err := c.nack(msg, err); err != nil {
+		c.reportError(msg, err)
+	}
+}
+
+// nack negatively acknowledges a message with the error of the handler as
+// its reason, honoring an ErrRetryAfter returned by the handler if the queue
+// supports it.
+func (c *Consumer) nack(msg Msg, handlerErr error) error {
+	var retryAfter *ErrRetryAfter
+	if dn, ok := c.queue.(delayedNacker); ok && errors.As(handlerErr, &retryAfter) {
+		return dn.NackWithDelayAndReason(context.Background(), msg.ID, retryAfter.Delay, handlerErr)
+	}
+	if rn, ok := c.queue.(reasonNacker); ok {
+		return rn.NackWithReason(context.Background(), msg.ID, handlerErr)
+	}
+	return c.queue.Nack(msg.ID)
+}
+
+// handle runs the handler, turning a panic into an error.
+func (c *Consumer) handle(ctx context.Context, msg Msg) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &ErrHandlerPanic{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return c.handler(ctx, msg)
+}
+
+func (c *Consumer) reportError(msg Msg, err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(msg, err)
+	}
+}
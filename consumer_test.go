@@ -0,0 +1,166 @@
+package gopq_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+// runConsumer runs a consumer in the background. The returned function
+// cancels it, waits for it to return and returns the error of Run.
+func runConsumer(t *testing.T, c *gopq.Consumer) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		err = c.Run(ctx)
+	}()
+	return func() error {
+		cancel()
+		<-done
+		return err
+	}
+}
+
+func TestConsumer_ProcessesAllMessages(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute})
+
+	const count = 50
+	for i := 0; i < count; i++ {
+		require.NoError(t, q.Enqueue([]byte(fmt.Sprintf("item %d", i))))
+	}
+
+	var mu sync.Mutex
+	seen := map[string]int{}
+	all := make(chan struct{})
+	stop := runConsumer(t, gopq.NewConsumer(q, func(ctx context.Context, msg gopq.Msg) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[string(msg.Item)]++
+		if len(seen) == count {
+			close(all)
+		}
+		return nil
+	}, gopq.ConsumerOpts{Workers: 4}))
+
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not all messages were processed")
+	}
+	stop()
+
+	for item, n := range seen {
+		assert.Equal(t, 1, n, item)
+	}
+	assertLen(t, q, 0)
+}
+
+func TestConsumer_NacksFailedMessages(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	dlq := setupTestQueue(t)
+	q.RegisterDeadLetterQueue(dlq)
+
+	require.NoError(t, q.Enqueue([]byte("fails")))
+	require.NoError(t, q.Enqueue([]byte("panics")))
+
+	handlerErr := errors.New("downstream unavailable")
+	errs := make(chan error, 2)
+	stop := runConsumer(t, gopq.NewConsumer(q, func(ctx context.Context, msg gopq.Msg) error {
+		if string(msg.Item) == "panics" {
+			panic("boom")
+		}
+		return handlerErr
+	}, gopq.ConsumerOpts{
+		OnError: func(msg gopq.Msg, err error) { errs <- err },
+	}))
+
+	var reported []error
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			reported = append(reported, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler errors were not reported")
+		}
+	}
+	stop()
+
+	assert.ErrorIs(t, reported[0], handlerErr)
+	var panicErr *gopq.ErrHandlerPanic
+	require.ErrorAs(t, reported[1], &panicErr)
+	assert.Equal(t, "boom", panicErr.Value)
+
+	for _, item := range []string{"fails", "panics"} {
+		msg, err := dlq.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, item, string(msg.Item))
+	}
+}
+
+func TestConsumer_GracefulShutdown(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, q.Enqueue([]byte("slow")))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stop := runConsumer(t, gopq.NewConsumer(q, func(ctx context.Context, msg gopq.Msg) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	}, gopq.ConsumerOpts{}))
+
+	<-started
+	stopped := make(chan struct{})
+	var err error
+	go func() {
+		err = stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("consumer returned before the handler finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	<-stopped
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The handler kept its context, so the message was acknowledged.
+	assertLen(t, q, 0)
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+}
+
+func TestConsumer_ShutdownTimeoutCancelsHandlers(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 3})
+	require.NoError(t, q.Enqueue([]byte("stuck")))
+
+	started := make(chan struct{})
+	stop := runConsumer(t, gopq.NewConsumer(q, func(ctx context.Context, msg gopq.Msg) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, gopq.ConsumerOpts{ShutdownTimeout: 50 * time.Millisecond}))
+
+	<-started
+	var timeout *gopq.ErrShutdownTimeout
+	assert.ErrorAs(t, stop(), &timeout)
+
+	// The message was nacked and waits for its retry.
+	require.NoError(t, q.ExpireAck(1))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, msg.RetryCount)
+}
@@ -0,0 +1,202 @@
+package gopq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+)
+
+// deadLetterAttributePrefix starts the names of all dead letter attributes.
+const deadLetterAttributePrefix = "dead_letter_"
+
+// Attributes under which RegisterDeadLetterQueue stores the fields of a
+// DeadLetter alongside the failed item. Times are formatted as RFC 3339 and
+// the failures as a JSON array, so they can be queried with the JSON
+// functions of SQLite, e.g. json_extract(attributes, '$.dead_letter_last_error').
+const (
+	DeadLetterQueueAttribute          = "dead_letter_queue"
+	DeadLetterAttemptsAttribute       = "dead_letter_attempts"
+	DeadLetterFirstAttemptAtAttribute = "dead_letter_first_attempt_at"
+	DeadLetterLastAttemptAtAttribute  = "dead_letter_last_attempt_at"
+	DeadLetterLastErrorAttribute      = "dead_letter_last_error"
+	DeadLetterFailuresAttribute       = "dead_letter_failures"
+)
+
+// expiredReason is the LastError of messages that failed by expiring.
+const expiredReason = "time-to-live expired"
+
+// DeadLetter describes a message that has exhausted its retries, or expired
+// with AckOpts.ExpireAsFailure set.
+type DeadLetter struct {
+	Msg
+
+	// Queue is the name of the table that held the message. For consumer
+	// groups it is the topic's table name and the group name, joined by
+	// a dot.
+	Queue string
+
+	// Attempts is the number of deliveries that ended in a negative
+	// acknowledgement.
+	Attempts int
+
+	// FirstAttemptAt and LastAttemptAt are the times the message was first
+	// and last dequeued.
+	FirstAttemptAt time.Time
+	LastAttemptAt  time.Time
+
+	// LastError is the reason given for the last failure, or empty if
+	// none was given.
+	LastError string
+
+	// Failures are the reasons given with NackWithReason, oldest first.
+	Failures []Failure
+}
+
+// Failure is a reason given for a failed delivery.
+type Failure struct {
+	At    time.Time
+	Error string
+}
+
+// failureRecord is the stored form of a Failure.
+type failureRecord struct {
+	At    int64  `json:"at"`
+	Error string `json:"error"`
+}
+
+// TryNackWithReason indicates that an item processing has failed with err
+// and should be requeued. The error is added to the failure history of the
+// message, which is handed to the dead letter callbacks once the message
+// has exhausted its retries.
+// This is non-blocking, and will return immediately.
+func (q *AcknowledgeableQueue) TryNackWithReason(ctx context.Context, id int64, err error) error {
+	return q.nack(ctx, id, q.AckOpts.retryDelay, nackReason(err))
+}
+
+// nackReason returns the failure reason recorded for err.
+func nackReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// NackWithReason indicates that an item processing has failed with err and
+// should be requeued. The error is added to the failure history of the
+// message, which is handed to the dead letter callbacks once the message
+// has exhausted its retries.
+// If the db is locked, this will block until the db is unlocked.
+func (q *AcknowledgeableQueue) NackWithReason(ctx context.Context, id int64, err error) error {
+	return retryWhileLocked(ctx, q.pollInterval, func(ctx context.Context) error {
+		return handleLockedResult(q.TryNackWithReason(ctx, id, err))
+	})
+}
+
+// reasonNacker is implemented by queues that record why a message failed.
+type reasonNacker interface {
+	NackWithReason(ctx context.Context, id int64, err error) error
+}
+
+// RegisterOnDeadLetterCallback adds a callback to the queue that is called
+// with the dead letter record of a message that has exhausted its retries.
+func (q *AcknowledgeableQueue) RegisterOnDeadLetterCallback(fn func(dl DeadLetter) error) {
+	q.DeadLetterCallbacks = append(q.DeadLetterCallbacks, fn)
+}
+
+// deadLetterAttributes returns the attributes of a message together with
+// the fields of its dead letter record.
+func deadLetterAttributes(dl DeadLetter) (map[string]string, error) {
+	attributes := maps.Clone(dl.Attributes)
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	attributes[DeadLetterQueueAttribute] = dl.Queue
+	attributes[DeadLetterAttemptsAttribute] = strconv.Itoa(dl.Attempts)
+	if !dl.FirstAttemptAt.IsZero() {
+		attributes[DeadLetterFirstAttemptAtAttribute] = dl.FirstAttemptAt.UTC().Format(time.RFC3339Nano)
+	}
+	if !dl.LastAttemptAt.IsZero() {
+		attributes[DeadLetterLastAttemptAtAttribute] = dl.LastAttemptAt.UTC().Format(time.RFC3339Nano)
+	}
+	attributes[DeadLetterLastErrorAttribute] = dl.LastError
+	if len(dl.Failures) > 0 {
+		failures, err := encodeFailures(dl.Failures)
+		if err != nil {
+			return nil, err
+		}
+		attributes[DeadLetterFailuresAttribute] = failures
+	}
+	return attributes, nil
+}
+
+// ParseDeadLetter reads the dead letter record stored by
+// RegisterDeadLetterQueue from the attributes of a message of the dead
+// letter queue. The returned Msg is msg itself.
+func ParseDeadLetter(msg Msg) (DeadLetter, error) {
+	queue, ok := msg.Attributes[DeadLetterQueueAttribute]
+	if !ok {
+		return DeadLetter{}, fmt.Errorf("message %d is not a dead letter", msg.ID)
+	}
+	dl := DeadLetter{
+		Msg:       msg,
+		Queue:     queue,
+		LastError: msg.Attributes[DeadLetterLastErrorAttribute],
+	}
+
+	var err error
+	if v, ok := msg.Attributes[DeadLetterAttemptsAttribute]; ok {
+		if dl.Attempts, err = strconv.Atoi(v); err != nil {
+			return DeadLetter{}, fmt.Errorf("failed to parse dead letter attempts: %w", err)
+		}
+	}
+	if v, ok := msg.Attributes[DeadLetterFirstAttemptAtAttribute]; ok {
+		if dl.FirstAttemptAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return DeadLetter{}, fmt.Errorf("failed to parse dead letter first attempt: %w", err)
+		}
+	}
+	if v, ok := msg.Attributes[DeadLetterLastAttemptAtAttribute]; ok {
+		if dl.LastAttemptAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return DeadLetter{}, fmt.Errorf("failed to parse dead letter last attempt: %w", err)
+		}
+	}
+	if v, ok := msg.Attributes[DeadLetterFailuresAttribute]; ok {
+		dl.Failures, err = decodeFailures(sql.NullString{String: v, Valid: true})
+		if err != nil {
+			return DeadLetter{}, err
+		}
+	}
+	return dl, nil
+}
+
+// encodeFailures returns the stored form of a failure history.
+func encodeFailures(failures []Failure) (string, error) {
+	records := make([]failureRecord, len(failures))
+	for i, f := range failures {
+		records[i] = failureRecord{At: f.At.UnixMilli(), Error: f.Error}
+	}
+	encoded, err := json.Marshal(records)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode failures: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// decodeFailures parses a stored failure history.
+func decodeFailures(encoded sql.NullString) ([]Failure, error) {
+	if !encoded.Valid || encoded.String == "" {
+		return nil, nil
+	}
+	var records []failureRecord
+	if err := json.Unmarshal([]byte(encoded.String), &records); err != nil {
+		return nil, fmt.Errorf("failed to decode failures: %w", err)
+	}
+	failures := make([]Failure, len(records))
+	for i, r := range records {
+		failures[i] = Failure{At: time.UnixMilli(r.At), Error: r.Error}
+	}
+	return failures, nil
+}
@@ -0,0 +1,113 @@
+package gopq_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
+)
+
+func TestAckQueue_DeadLetterRecord(t *testing.T) {
+	start := time.Now()
+	clock := gopqtest.NewClock(start)
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 1, CommonOpts: gopq.CommonOpts{Clock: clock}})
+	ctx := context.Background()
+
+	var dead gopq.DeadLetter
+	q.RegisterOnDeadLetterCallback(func(dl gopq.DeadLetter) error {
+		dead = dl
+		return nil
+	})
+	require.NoError(t, q.Enqueue([]byte("poison")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.NackWithReason(ctx, msg.ID, errors.New("timeout")))
+
+	clock.Advance(time.Hour)
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.NackWithReason(ctx, msg.ID, errors.New("connection refused")))
+
+	assert.Equal(t, "poison", string(dead.Item))
+	assert.Contains(t, dead.Queue, "ack_queue")
+	assert.Equal(t, 2, dead.Attempts)
+	assert.Equal(t, start.UnixMilli(), dead.FirstAttemptAt.UnixMilli())
+	assert.Equal(t, start.Add(time.Hour).UnixMilli(), dead.LastAttemptAt.UnixMilli())
+	assert.Equal(t, "connection refused", dead.LastError)
+	require.Len(t, dead.Failures, 2)
+	assert.Equal(t, "timeout", dead.Failures[0].Error)
+	assert.Equal(t, start.UnixMilli(), dead.Failures[0].At.UnixMilli())
+}
+
+func TestAckQueue_DeadLetterQueueStoresRecord(t *testing.T) {
+	path := tempFilePath(t)
+	b, err := gopq.NewBroker(path)
+	require.NoError(t, err)
+	defer b.Close()
+
+	q, err := b.AckQueue("jobs", gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	require.NoError(t, err)
+	dlq, err := b.SimpleQueue("jobs_dlq")
+	require.NoError(t, err)
+	q.RegisterDeadLetterQueue(dlq)
+
+	ctx := context.Background()
+	require.NoError(t, q.EnqueueWithAttributes(ctx, []byte("poison"), map[string]string{"trace-id": "abc"}))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.NackWithReason(ctx, msg.ID, errors.New("bad payload")))
+
+	// The record can be queried in SQL...
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	var lastError string
+	err = db.QueryRow("SELECT json_extract(attributes, '$.dead_letter_last_error') FROM simple_queue_jobs_dlq").Scan(&lastError)
+	require.NoError(t, err)
+	assert.Equal(t, "bad payload", lastError)
+
+	// ...and read back from the dead letter queue.
+	msg, err = dlq.TryDequeue()
+	require.NoError(t, err)
+	dl, err := gopq.ParseDeadLetter(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "ack_queue_jobs", dl.Queue)
+	assert.Equal(t, 1, dl.Attempts)
+	assert.Equal(t, "bad payload", dl.LastError)
+	assert.False(t, dl.FirstAttemptAt.IsZero())
+	require.Len(t, dl.Failures, 1)
+	assert.Equal(t, "abc", dl.Attributes["trace-id"])
+
+	_, err = gopq.ParseDeadLetter(gopq.Msg{ID: 1})
+	assert.Error(t, err)
+}
+
+func TestConsumer_NacksWithHandlerError(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	dead := make(chan gopq.DeadLetter, 1)
+	q.RegisterOnDeadLetterCallback(func(dl gopq.DeadLetter) error {
+		dead <- dl
+		return nil
+	})
+	stop := runConsumer(t, gopq.NewConsumer(q, func(ctx context.Context, msg gopq.Msg) error {
+		return errors.New("handler failed")
+	}, gopq.ConsumerOpts{}))
+	defer stop()
+
+	select {
+	case dl := <-dead:
+		assert.Equal(t, "handler failed", dl.LastError)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not dead lettered")
+	}
+}
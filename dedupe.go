@@ -0,0 +1,99 @@
+package gopq
+
+import (
+	"context"
+	"crypto/sha256"
+)
+
+// dedupeKeyColumn holds the deduplication key of the items of unique
+// queues. Tables created before it existed are rebuilt, as their unique
+// constraint is on the item.
+const dedupeKeyColumn = "dedupe_key"
+
+const (
+	uniqueDelayedEnqueueQuery = `
+        INSERT INTO %s (item, visible_at, expires_at, dedupe_key, codec, enqueued_at) VALUES (?, ?, ?, ?, ?, ?)
+    `
+	uniqueAttributesEnqueueQuery = `
+        INSERT INTO %s (item, attributes, expires_at, dedupe_key, codec, enqueued_at) VALUES (?, ?, ?, ?, ?, ?)
+    `
+)
+
+// KeyFunc returns the deduplication key of an item. Items of a unique queue
+// with the same key are enqueued only once, regardless of their content.
+// An empty key makes the item unique by its content instead.
+type KeyFunc func(item []byte) string
+
+// WithKeyFunc makes a unique queue deduplicate items by the key fn returns
+// for them rather than by their content. Other queues ignore it.
+func WithKeyFunc(fn KeyFunc) QueueOptions {
+	return func(o *Opts) error {
+		o.KeyFunc = fn
+		return nil
+	}
+}
+
+// EnqueueWithKey adds an item to a unique queue unless an item with the
+// same deduplication key is already in it. The key takes precedence over
+// the queue's KeyFunc. Only queues created with NewUniqueQueue or
+// NewUniqueAckQueue support keys; other queues return ErrUnsupported.
+// If the db is locked, this will block until the db is unlocked.
+func (q *Queue) EnqueueWithKey(ctx context.Context, key string, item []byte) error {
+	return retryWhileLocked(ctx, q.pollInterval, func(ctx context.Context) error {
+		return q.TryEnqueueWithKey(ctx, key, item)
+	})
+}
+
+// TryEnqueueWithKey attempts to add an item to a unique queue unless an
+// item with the same deduplication key is already in it.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryEnqueueWithKey(ctx context.Context, key string, item []byte) error {
+	if !q.mode.is(modeKeyed) {
+		return &ErrUnsupported{Op: "EnqueueWithKey"}
+	}
+	stored, codec, err := q.compress(item)
+	if err != nil {
+		return err
+	}
+	return q.execEnqueue(ctx, q.queries.enqueue, stored, q.expiresAt(q.opts.TTL), q.dedupeKey(item, key), codec, q.now())
+}
+
+// enqueueArgs returns the arguments of an enqueue query for item. The
+// queries of unique queues take the deduplication key after args, and the
+// queries of SQLite queues end with the codec of the stored item and the
+// enqueue time.
+func (q *Queue) enqueueArgs(item []byte, args ...any) ([]any, error) {
+	stored, codec, err := q.compress(item)
+	if err != nil {
+		return nil, err
+	}
+	all := append([]any{stored}, args...)
+	if q.mode.is(modeKeyed) {
+		var key string
+		if q.opts.KeyFunc != nil {
+			key = q.opts.KeyFunc(item)
+		}
+		all = append(all, q.dedupeKey(item, key))
+	}
+	if q.mode.is(modeCodec) {
+		all = append(all, codec, q.now())
+	}
+	return all, nil
+}
+
+// dedupeKey returns the stored form of the deduplication key of item.
+// Items without a key store NULL and are unique by their stored content. If
+// the queue compresses items, whose stored form may differ for the same
+// content, they store a SHA-256 hash of the uncompressed item instead. It is
+// a blob, so it never equals a key.
+func (q *Queue) dedupeKey(item []byte, key string) any {
+	switch {
+	case key != "":
+		return key
+	case q.opts.Compression != nil:
+		sum := sha256.Sum256(item)
+		return sum[:]
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,120 @@
+package gopq_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestUniqueQueue_EnqueueWithKey(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueWithKey(ctx, "reindex:42", []byte(`{"doc":42,"req":"a"}`)))
+	require.NoError(t, q.EnqueueWithKey(ctx, "reindex:42", []byte(`{"doc":42,"req":"b"}`)))
+	require.NoError(t, q.EnqueueWithKey(ctx, "reindex:43", []byte(`{"doc":42,"req":"a"}`)))
+	assertQueueLen(t, q, 2)
+
+	// Items without a key stay unique by their content.
+	require.NoError(t, q.Enqueue([]byte("plain")))
+	require.NoError(t, q.Enqueue([]byte("plain")))
+	assertQueueLen(t, q, 3)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, `{"doc":42,"req":"a"}`, string(msg.Item))
+
+	// The key is free again once the item has been dequeued.
+	require.NoError(t, q.EnqueueWithKey(ctx, "reindex:42", []byte(`{"doc":42,"req":"c"}`)))
+	assertQueueLen(t, q, 3)
+
+	err = setupTestQueue(t).EnqueueWithKey(ctx, "key", []byte("item"))
+	var unsupported *gopq.ErrUnsupported
+	assert.ErrorAs(t, err, &unsupported)
+}
+
+func TestUniqueQueue_KeyFunc(t *testing.T) {
+	docID := func(item []byte) string {
+		id, _, _ := bytes.Cut(item, []byte("|"))
+		return string(id)
+	}
+	q, err := gopq.NewUniqueQueue("", gopq.WithKeyFunc(docID))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("doc-1|first")))
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("doc-1|second"), time.Minute))
+	require.NoError(t, q.EnqueueWithAttributes(ctx, []byte("doc-1|third"), map[string]string{"a": "b"}))
+	ids, err := q.EnqueueBatch(ctx, [][]byte{[]byte("doc-2|first"), []byte("doc-2|second")})
+	require.NoError(t, err)
+	assert.NotZero(t, ids[0])
+	assert.Zero(t, ids[1])
+	assertQueueLen(t, q, 2)
+
+	// An explicit key takes precedence over the KeyFunc.
+	require.NoError(t, q.EnqueueWithKey(ctx, "other", []byte("doc-1|fourth")))
+	assertQueueLen(t, q, 3)
+}
+
+func TestUniqueAckQueue_KeyFunc(t *testing.T) {
+	q := setupTestUniqueAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		CommonOpts: gopq.CommonOpts{
+			KeyFunc: func(item []byte) string {
+				return string(item[:1])
+			},
+		},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("a1")))
+	require.NoError(t, q.Enqueue([]byte("a2")))
+	require.NoError(t, q.EnqueueWithKey(ctx, "a", []byte("b1")))
+	assertLen(t, q, 1)
+
+	// Messages keep their key while they are in flight.
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue([]byte("a3")))
+	require.NoError(t, q.Ack(msg.ID))
+	assertLen(t, q, 0)
+}
+
+func TestUniqueQueue_MigratesItemConstraint(t *testing.T) {
+	path := tempFilePath(t)
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE unique_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			item BLOB NOT NULL,
+			enqueued_at INTEGER,
+			UNIQUE(item) ON CONFLICT IGNORE
+		);
+		INSERT INTO unique_queue (item, enqueued_at) VALUES (CAST('old' AS BLOB), 1700000000);
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	q, err := gopq.NewUniqueQueue(path)
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("old")))
+	require.NoError(t, q.EnqueueWithKey(ctx, "key", []byte("old")))
+	assertQueueLen(t, q, 2)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(msg.Item))
+	assert.Equal(t, int64(1700000000000), msg.EnqueuedAt.UnixMilli())
+}
@@ -0,0 +1,78 @@
+package gopq
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	delayedEnqueueQuery = `
+        INSERT INTO %s (item, visible_at, expires_at, codec, enqueued_at) VALUES (?, ?, ?, ?, ?)
+    `
+	delayedNextVisibleQuery = `
+        SELECT MIN(visible_at) FROM %s WHERE processed_at IS NULL AND visible_at > ?
+    `
+	uniqueNextVisibleQuery = `
+        SELECT MIN(visible_at) FROM %s WHERE visible_at > ?
+    `
+)
+
+// EnqueueAt adds an item to the queue that stays invisible to dequeue
+// operations and Len until the given time.
+// It returns an error if the operation fails or the context is cancelled.
+func (q *Queue) EnqueueAt(ctx context.Context, item []byte, at time.Time) error {
+	return retryWhileLocked(ctx, defaultPollInterval, func(ctx context.Context) error {
+		return q.TryEnqueueAt(ctx, item, at)
+	})
+}
+
+// TryEnqueueAt attempts to add an item to the queue that stays invisible
+// until the given time.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryEnqueueAt(ctx context.Context, item []byte, at time.Time) error {
+	if q.queries.enqueueAt == "" {
+		return &ErrUnsupported{Op: "EnqueueAt"}
+	}
+	return q.tryEnqueue(ctx, q.queries.enqueueAt, item, at.UnixMilli(), q.expiresAfter(at, q.opts.TTL))
+}
+
+// EnqueueAfter adds an item to the queue that stays invisible to dequeue
+// operations and Len until the given delay has passed.
+// It returns an error if the operation fails or the context is cancelled.
+func (q *Queue) EnqueueAfter(ctx context.Context, item []byte, delay time.Duration) error {
+	return q.EnqueueAt(ctx, item, q.opts.Clock.Now().Add(delay))
+}
+
+// TryEnqueueAfter attempts to add an item to the queue that stays invisible
+// until the given delay has passed.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryEnqueueAfter(ctx context.Context, item []byte, delay time.Duration) error {
+	return q.TryEnqueueAt(ctx, item, q.opts.Clock.Now().Add(delay))
+}
+
+// untilVisible returns how long it takes until the earliest scheduled item
+// becomes visible. It returns false if no item is scheduled. Once it found
+// none, it only looks again after the queue enqueued another scheduled item;
+// items scheduled by other processes are dequeued at the next poll instead.
+func (q *Queue) untilVisible(ctx context.Context) (time.Duration, bool) {
+	if q.queries.nextVisible == "" {
+		return 0, false
+	}
+	scheduled := q.scheduled.Load()
+	if q.unscheduledAt.Load() == scheduled+1 {
+		return 0, false
+	}
+
+	var next sql.NullInt64
+	now := q.opts.Clock.Now()
+	err := q.db.QueryRowContext(ctx, q.queries.nextVisible, now.UnixMilli()).Scan(&next)
+	if err != nil {
+		return 0, false
+	}
+	if !next.Valid {
+		q.unscheduledAt.Store(scheduled + 1)
+		return 0, false
+	}
+	return time.UnixMilli(next.Int64).Sub(now), true
+}
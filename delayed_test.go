@@ -0,0 +1,137 @@
+package gopq_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestQueue_EnqueueAtFuture(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueAt(ctx, []byte("later"), time.Now().Add(time.Hour)))
+	require.NoError(t, q.Enqueue([]byte("now")))
+
+	count, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "now", string(msg.Item))
+
+	_, err = q.TryDequeue()
+	assert.Error(t, err)
+}
+
+func TestQueue_EnqueueAtPast(t *testing.T) {
+	q := setupTestQueue(t)
+
+	require.NoError(t, q.EnqueueAt(context.Background(), []byte("overdue"), time.Now().Add(-time.Hour)))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "overdue", string(msg.Item))
+}
+
+func TestQueue_DequeueWaitsForScheduledItem(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("delayed"), 2*time.Second))
+
+	_, err := q.TryDequeue()
+	assert.Error(t, err)
+
+	msg, err := q.DequeueCtx(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "delayed", string(msg.Item))
+}
+
+func TestQueue_WaitingDequeueGetsLaterScheduledItem(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The dequeue polls the empty queue for a while before the item is
+	// scheduled, so it has already found no scheduled items.
+	got := make(chan string, 1)
+	go func() {
+		msg, err := q.DequeueCtx(ctx)
+		assert.NoError(t, err)
+		got <- string(msg.Item)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("delayed"), 100*time.Millisecond))
+
+	select {
+	case item := <-got:
+		assert.Equal(t, "delayed", item)
+	case <-ctx.Done():
+		t.Fatal("scheduled item was not dequeued")
+	}
+}
+
+func TestAckQueue_EnqueueAfter(t *testing.T) {
+	q := setupDefaultTestAckQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("later"), time.Hour))
+	assertLen(t, q, 0)
+
+	_, err := q.TryDequeue()
+	assert.Error(t, err)
+}
+
+func TestUniqueQueue_EnqueueAfter(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("later"), time.Hour))
+	require.NoError(t, q.Enqueue([]byte("later"))) // duplicate of a scheduled item
+
+	count, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestSimpleQueue_MigratesExistingTable(t *testing.T) {
+	tempFile := tempFilePath(t)
+
+	// Create a table with the schema used before delayed delivery.
+	db, err := sql.Open("sqlite3", tempFile)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE simple_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			item BLOB NOT NULL,
+			enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			processed_at TIMESTAMP
+		);
+		INSERT INTO simple_queue (item) VALUES ('existing');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	q, err := gopq.NewSimpleQueue(tempFile)
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.EnqueueAfter(context.Background(), []byte("later"), time.Hour))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(msg.Item))
+
+	_, err = q.TryDequeue()
+	assert.Error(t, err)
+}
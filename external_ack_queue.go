@@ -18,9 +18,10 @@ func NewExternalAckQueue(db *sql.DB, ackOpts AckOpts, opts ...QueueOptions) (*Ac
 		DequeueDelete: "call gopq_ack_delete(?, ?)",
 	}
 	bq := baseQueries{
-		enqueue:    "call gopq_push_ack(?)",
-		tryDequeue: "call gopq_pop_ack(?, ?)",
-		len:        "call gopq_len_ack(?)",
+		enqueue:           "call gopq_push_ack(?, NULL, ?)",
+		enqueueAttributes: "call gopq_push_ack(?, ?, ?)",
+		tryDequeue:        "call gopq_pop_ack(?, ?)",
+		len:               "call gopq_len_ack(?)",
 	}
 	aq := ackQueries{
 		ackUtilsQueries: ackUtilsQueries{
@@ -37,17 +38,23 @@ func NewExternalAckQueue(db *sql.DB, ackOpts AckOpts, opts ...QueueOptions) (*Ac
 // NewExternalQueue creates a new queue based on external database. The
 // behaivour of the queue is based on database implementation details.
 func NewExternalAckQueueWithQueries(db *sql.DB, bq baseQueries, aq ackQueries, ackOpts AckOpts, opts ...QueueOptions) (*AcknowledgeableQueue, error) {
-	err := internal.PrepareDB(db, "", bq.enqueue, bq.tryDequeue, bq.len, aq.ack, aq.delete, aq.details, aq.forRetry, aq.expire)
+	qo := Opts{}
+	qo.Apply(opts...)
+
+	err := internal.PrepareDB(db, "", bq.enqueue, bq.enqueueAttributes, bq.tryDequeue, bq.len, aq.ack, aq.delete, aq.details, aq.forRetry, aq.expire)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create external queue: %w", err)
 	}
 
+	common := ackOpts.CommonOpts.or(qo.CommonOpts)
 	return &AcknowledgeableQueue{
 		Queue: Queue{
 			db:           db,
 			pollInterval: defaultPollInterval,
 			notifyChan:   internal.MakeNotifyChan(),
 			queries:      bq,
+			opts:         CommonOpts{TTL: common.TTL, Clock: queueClock(common.Clock)},
+			mode:         modeExternal,
 		},
 		AckOpts:    ackOpts,
 		ackQueries: aq,
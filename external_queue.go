@@ -18,17 +18,23 @@ func NewExternalQueue(db *sql.DB, opts ...QueueOptions) (*Queue, error) {
 		DequeueDelete: "call gopq_pop_delete()",
 	}
 	q := baseQueries{
-		enqueue:    "call gopq_push(?)",
-		tryDequeue: dequeue[qo.DequeueAction],
-		len:        "call gopq_len()",
+		enqueue:           "call gopq_push(?, NULL, ?)",
+		enqueueAttributes: "call gopq_push(?, ?, ?)",
+		tryDequeue:        dequeue[qo.DequeueAction],
+		len:               "call gopq_len()",
 	}
 	return NewExternalQueueWithQueries(db, q, opts...)
 }
 
 // NewExternalQueue creates a new queue based on external database. The
 // behaivour of the queue is based on database implementation details.
+// The dequeue and length procedures take no arguments and read the current
+// time from the database.
 func NewExternalQueueWithQueries(db *sql.DB, q baseQueries, opts ...QueueOptions) (*Queue, error) {
-	err := internal.PrepareDB(db, "", q.enqueue, q.tryDequeue, q.len)
+	qo := Opts{}
+	qo.Apply(opts...)
+
+	err := internal.PrepareDB(db, "", q.enqueue, q.enqueueAttributes, q.tryDequeue, q.len)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create external queue: %w", err)
 	}
@@ -38,6 +44,8 @@ func NewExternalQueueWithQueries(db *sql.DB, q baseQueries, opts ...QueueOptions
 		pollInterval: defaultPollInterval,
 		notifyChan:   internal.MakeNotifyChan(),
 		queries:      q,
+		opts:         CommonOpts{TTL: qo.TTL, Clock: queueClock(qo.Clock)},
+		mode:         modeExternal | modeDBClock,
 	}, nil
 
 }
@@ -0,0 +1,41 @@
+// Package gopqtest provides helpers for testing code built on gopq.
+package gopqtest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a gopq.Clock that only moves when told to. Pass it to a queue with
+// gopq.WithClock or gopq.AckOpts.Clock to expire ack deadlines, run out retry
+// backoffs and deliver delayed items without sleeping.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 )
 
 func InitializeDB(fileName string) (*sql.DB, error) {
@@ -13,7 +14,7 @@ func InitializeDB(fileName string) (*sql.DB, error) {
 		dbPath = "file::memory:?cache=shared"
 	} else {
 		log.Println("Using SQLite database", "path", fileName)
-		dbPath = fmt.Sprintf("file:%s?_journal_mode=WAL", fileName)
+		dbPath = fmt.Sprintf("file:%s?_journal_mode=WAL&_auto_vacuum=incremental", fileName)
 	}
 
 	db, err := sql.Open("sqlite3", dbPath)
@@ -43,3 +44,180 @@ func PrepareDB(db *sql.DB, createTableQuery string, queries ...string) error {
 
 	return nil
 }
+
+// Column describes a column that was added to a queue table after the
+// table was first released.
+type Column struct {
+	Name       string
+	Definition string
+}
+
+// MigrateTable adds any of the given columns that an existing table lacks.
+// Tables that do not exist yet are left alone, as they are created with the
+// current schema.
+func MigrateTable(db *sql.DB, table string, columns ...Column) error {
+	existing, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+
+	for _, c := range columns {
+		if existing[c.Name] {
+			continue
+		}
+		_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, c.Name, c.Definition))
+		if err != nil {
+			return fmt.Errorf("failed to add column %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// millisThreshold separates timestamps stored in Unix seconds by earlier
+// versions from Unix milliseconds. 1e11 milliseconds is early 1973, while
+// 1e11 seconds lies in the year 5138.
+const millisThreshold = 100000000000
+
+// migrationsTable records the one-off migrations that have been run on the
+// tables of a database.
+const migrationsTable = `
+	CREATE TABLE IF NOT EXISTS gopq_migrations (
+		table_name TEXT NOT NULL,
+		migration TEXT NOT NULL,
+		PRIMARY KEY (table_name, migration)
+	)
+`
+
+// MigrateMillis converts the timestamps of a table written by earlier
+// versions, either Unix seconds or SQLite TIMESTAMP text, to Unix
+// milliseconds. Columns the table lacks are skipped. The conversion runs
+// once per table and is recorded in the gopq_migrations table; tables that
+// do not exist yet are recorded right away, as they are created with
+// millisecond timestamps.
+func MigrateMillis(db *sql.DB, table string, columns ...string) error {
+	if _, err := db.Exec(migrationsTable); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	var done int
+	err := db.QueryRow("SELECT COUNT(*) FROM gopq_migrations WHERE table_name = ? AND migration = 'millis'", table).Scan(&done)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+	if done > 0 {
+		return nil
+	}
+
+	existing, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
+
+	for _, c := range columns {
+		if !existing[c] {
+			continue
+		}
+		_, err := tx.Exec(fmt.Sprintf(`
+			UPDATE %[1]s
+			SET %[2]s = CASE
+				WHEN typeof(%[2]s) = 'text' THEN CAST(unixepoch(%[2]s, 'subsec') * 1000 AS INTEGER)
+				ELSE %[2]s * 1000
+			END
+			WHERE typeof(%[2]s) = 'text' OR %[2]s < %[3]d
+		`, table, c, millisThreshold))
+		if err != nil {
+			return fmt.Errorf("failed to migrate column %s to milliseconds: %w", c, err)
+		}
+	}
+
+	// Another connection may have migrated the table in the meantime.
+	_, err = tx.Exec("INSERT OR IGNORE INTO gopq_migrations (table_name, migration) VALUES (?, 'millis')", table)
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RebuildTable recreates a table written by earlier versions that lacks the
+// column marker, for schema changes ALTER TABLE cannot make such as changing
+// a constraint. createTable is a CREATE TABLE statement with the table name
+// as its only format argument. The rows are copied into the new table in a
+// single transaction, keeping the columns both tables share, and indexes are
+// dropped with the old table. Tables that do not exist yet or already have
+// the marker column are left alone.
+func RebuildTable(db *sql.DB, table string, marker string, createTable string) error {
+	existing, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 || existing[marker] {
+		return nil
+	}
+	columns := make([]string, 0, len(existing))
+	for c := range existing {
+		columns = append(columns, c)
+	}
+	copied := strings.Join(columns, ", ")
+	rebuilt := table + "_rebuild"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
+
+	for _, query := range []string{
+		fmt.Sprintf(createTable, rebuilt),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", rebuilt, copied, copied, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuilt, table),
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to rebuild table %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// tableColumns returns the names of the columns of a table. It is empty if
+// the table does not exist.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read table info: %w", err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	return existing, nil
+}
@@ -12,11 +12,17 @@ var queueCounter uint64
 // Otherwise, we use the fileName as the table name.
 func DetermineTableName(prefix string, fileName string) string {
 	if fileName == "" {
-		return fmt.Sprintf("%s_%d", prefix, atomic.AddUint64(&queueCounter, 1))
+		return prefix + UniqueSuffix()
 	}
 	return prefix
 }
 
+// UniqueSuffix returns a table name suffix that is unique within the process.
+// In-memory queues share one database, so their tables need unique names.
+func UniqueSuffix() string {
+	return fmt.Sprintf("_%d", atomic.AddUint64(&queueCounter, 1))
+}
+
 // MakeNotifyChan creates a new channel with a buffer of 1.
 // This is used to notify the queue that an item has been enqueued.
 // I'm not sure if this is the best way to do this, but it works for now.
@@ -0,0 +1,117 @@
+package gopq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// minKeepAliveInterval is the shortest interval at which KeepAlive renews a
+// lease. Deadlines are stored in milliseconds, so renewing more often gains
+// nothing.
+const minKeepAliveInterval = time.Millisecond
+
+// TryExtendAck pushes the ack deadline of a message that is still in flight
+// to d from now, giving its consumer more time to process it.
+// It returns ErrAckDeadlineExpired if the deadline has already passed and
+// ErrMessageNotFound if the message does not exist.
+// This is non-blocking, and will return immediately.
+func (q *AcknowledgeableQueue) TryExtendAck(ctx context.Context, id int64, d time.Duration) error {
+	if q.ackQueries.extend == "" {
+		return &ErrUnsupported{Op: "ExtendAck"}
+	}
+	if d <= 0 {
+		return fmt.Errorf("invalid ack extension %v: must be positive", d)
+	}
+
+	now := q.opts.Clock.Now()
+	res, err := q.db.ExecContext(ctx, q.ackQueries.extend, now.Add(d).UnixMilli(), id, now.UnixMilli())
+	if err != nil {
+		return handleLockedResult(fmt.Errorf("failed to extend ack deadline: %w", err))
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// Nothing was extended, find out why.
+	var retryCount int
+	var ackDeadline sql.NullInt64
+	err = q.db.QueryRowContext(ctx, q.ackQueries.details, id).Scan(&retryCount, &ackDeadline)
+	if err == sql.ErrNoRows {
+		return &ErrMessageNotFound{ID: id}
+	}
+	if err != nil {
+		return handleLockedResult(fmt.Errorf("failed to get item details: %w", err))
+	}
+	return &ErrAckDeadlineExpired{ID: id}
+}
+
+// ExtendAck pushes the ack deadline of a message that is still in flight
+// to d from now, giving its consumer more time to process it.
+// It returns ErrAckDeadlineExpired if the deadline has already passed and
+// ErrMessageNotFound if the message does not exist.
+// If the db is locked, this will block until the db is unlocked.
+func (q *AcknowledgeableQueue) ExtendAck(ctx context.Context, id int64, d time.Duration) error {
+	return retryWhileLocked(ctx, q.pollInterval, func(ctx context.Context) error {
+		return q.TryExtendAck(ctx, id, d)
+	})
+}
+
+// KeepAlive runs fn while renewing the lease of the message with the given id
+// in the background. Every half AckTimeout, but at most once a millisecond,
+// the ack deadline is extended by AckTimeout, until fn returns. If the lease
+// is lost, because the deadline passed or the message is gone, the context
+// passed to fn is cancelled.
+// KeepAlive returns the error of fn. Queues that do not support ExtendAck
+// simply run fn. The renewals are paced by real time, not by the queue's
+// Clock.
+func (q *AcknowledgeableQueue) KeepAlive(ctx context.Context, id int64, fn func(ctx context.Context) error) error {
+	if q.ackQueries.extend == "" {
+		return fn(ctx)
+	}
+
+	lease := q.AckTimeout
+	if lease <= 0 {
+		lease = defaultAckTimeout
+	}
+	interval := max(lease/2, minKeepAliveInterval)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := q.TryExtendAck(ctx, id, lease)
+			if isMessageError(err) {
+				cancel()
+				return
+			}
+			// Other errors, such as a locked database, are retried on the
+			// next tick while the lease is still valid.
+		}
+	}()
+
+	err := fn(ctx)
+	close(done)
+	<-renewed
+	return err
+}
+
+// leaseKeeper is implemented by queues that support KeepAlive.
+type leaseKeeper interface {
+	KeepAlive(ctx context.Context, id int64, fn func(ctx context.Context) error) error
+}
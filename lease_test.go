@@ -0,0 +1,96 @@
+package gopq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestAckQueue_ExtendAck(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: 200 * time.Millisecond})
+	ctx := context.Background()
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.ExtendAck(ctx, msg.ID, time.Hour))
+
+	time.Sleep(300 * time.Millisecond)
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+	require.NoError(t, q.Ack(msg.ID))
+}
+
+func TestAckQueue_ExtendAckErrors(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute})
+	ctx := context.Background()
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Error(t, q.ExtendAck(ctx, msg.ID, 0))
+
+	require.NoError(t, q.ExpireAck(msg.ID))
+	var expired *gopq.ErrAckDeadlineExpired
+	assert.ErrorAs(t, q.ExtendAck(ctx, msg.ID, time.Minute), &expired)
+
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, q.ExtendAck(ctx, 999, time.Minute), &notFound)
+}
+
+func TestAckQueue_KeepAlive(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: 2 * time.Second})
+	require.NoError(t, q.Enqueue([]byte("slow")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+
+	err = q.KeepAlive(context.Background(), msg.ID, func(ctx context.Context) error {
+		time.Sleep(3500 * time.Millisecond)
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+
+	// The lease outlived the AckTimeout, so the message can still be acked.
+	require.NoError(t, q.Ack(msg.ID))
+}
+
+func TestAckQueue_KeepAliveTinyAckTimeout(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Nanosecond})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+
+	assert.NotPanics(t, func() {
+		err = q.KeepAlive(context.Background(), msg.ID, func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+}
+
+func TestAckQueue_KeepAliveCancelsOnLostLease(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: 2 * time.Second})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+
+	err = q.KeepAlive(context.Background(), msg.ID, func(ctx context.Context) error {
+		require.NoError(t, q.ExpireAck(msg.ID))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
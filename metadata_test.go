@@ -0,0 +1,60 @@
+package gopq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestQueue_DequeueReturnsEnqueuedAt(t *testing.T) {
+	q := setupTestQueue(t)
+
+	before := time.Now().Truncate(time.Second)
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.False(t, msg.EnqueuedAt.Before(before))
+	assert.WithinDuration(t, time.Now(), msg.EnqueuedAt, 2*time.Second)
+	assert.Zero(t, msg.RetryCount)
+	assert.True(t, msg.AckDeadline.IsZero())
+}
+
+func TestAckQueue_DequeueReturnsDeliveryMetadata(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 3})
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Zero(t, msg.RetryCount)
+	assert.WithinDuration(t, time.Now(), msg.EnqueuedAt, 2*time.Second)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), msg.AckDeadline, 2*time.Second)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		require.NoError(t, q.Nack(msg.ID))
+		require.NoError(t, q.ExpireAck(msg.ID))
+
+		msg, err = q.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, attempt, msg.RetryCount)
+	}
+}
+
+func TestAckQueue_DequeueBatchReturnsDeliveryMetadata(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute})
+
+	require.NoError(t, q.Enqueue([]byte("a")))
+	require.NoError(t, q.Enqueue([]byte("b")))
+
+	msgs, err := q.TryDequeueBatch(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, msgs[0].AckDeadline, msgs[1].AckDeadline)
+	assert.False(t, msgs[0].EnqueuedAt.IsZero())
+}
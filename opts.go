@@ -1,5 +1,10 @@
 package gopq
 
+import (
+	"fmt"
+	"time"
+)
+
 // Opts represents the queue-level settings for how dequeue is handled.
 const (
 	DequeueMark DequeueAction = iota
@@ -15,11 +20,96 @@ type (
 		// - DequeueMark (default behaivour) marks the record as done
 		// - DequeueDelete deletes the record.
 		DequeueAction DequeueAction
+
+		// PriorityAging makes waiting items of a priority queue gain one
+		// priority level for every full interval they have waited, so low
+		// priority items are eventually served. Zero disables aging.
+		PriorityAging time.Duration
+
+		CommonOpts
+	}
+
+	// CommonOpts holds the settings shared by all kinds of queues. It is
+	// embedded in Opts and AckOpts.
+	CommonOpts struct {
+		// TTL is the default time-to-live of enqueued items. Expired items
+		// are never dequeued. Delayed items expire TTL after they become
+		// visible. Zero means items never expire.
+		TTL time.Duration
+
+		// Clock is the source of the current time. Defaults to the system clock.
+		Clock Clock
+
+		// Retention limits how long processed items are kept. By default
+		// they are kept forever. Acknowledgeable queues only keep
+		// acknowledged items when their AckAction is AckMark.
+		Retention RetentionPolicy
+
+		// KeyFunc derives the deduplication key of the items of a unique
+		// queue. By default items are unique by their content.
+		KeyFunc KeyFunc
+
+		// Uniqueness determines whether a unique queue refuses duplicates
+		// of processed items as well, and DedupeWindow how long it keeps
+		// processed items to do so. Zero keeps them forever. Such queues
+		// mark processed items whatever their DequeueAction or AckAction.
+		Uniqueness   Uniqueness
+		DedupeWindow time.Duration
+
+		// Compression compresses items when they are stored. By default
+		// they are stored as they are.
+		Compression Compressor
+		// OnBackgroundError is called with the errors of the work a queue
+		// does in the background, such as purging expired items and
+		// enforcing the retention policy. The work is retried at the next
+		// interval either way. By default the errors are dropped.
+		OnBackgroundError func(err error)
 	}
 
 	QueueOptions func(*Opts) error
 )
 
+// or returns o with every unset setting taken from fallback. It is used by
+// acknowledgeable queues that accept both AckOpts and QueueOptions, where
+// the settings of AckOpts take precedence.
+func (o CommonOpts) or(fallback CommonOpts) CommonOpts {
+	if o.TTL == 0 {
+		o.TTL = fallback.TTL
+	}
+	if o.Clock == nil {
+		o.Clock = fallback.Clock
+	}
+	if !o.Retention.enabled() {
+		o.Retention = fallback.Retention
+	}
+	if o.KeyFunc == nil {
+		o.KeyFunc = fallback.KeyFunc
+	}
+	if o.Uniqueness == 0 && o.DedupeWindow == 0 {
+		o.Uniqueness = fallback.Uniqueness
+		o.DedupeWindow = fallback.DedupeWindow
+	}
+	if o.Compression == nil {
+		o.Compression = fallback.Compression
+	}
+	if o.OnBackgroundError == nil {
+		o.OnBackgroundError = fallback.OnBackgroundError
+	}
+	return o
+}
+
+// resolve returns the settings a queue runs with: the system clock if none
+// is set, and the compressor registered for reading.
+func (o CommonOpts) resolve() (CommonOpts, error) {
+	o.Clock = queueClock(o.Clock)
+	if o.Compression != nil {
+		if err := RegisterCompressor(o.Compression); err != nil {
+			return CommonOpts{}, err
+		}
+	}
+	return o, nil
+}
+
 func (co *Opts) Apply(opts ...QueueOptions) error {
 	for _, op := range opts {
 		if err := op(co); err != nil {
@@ -42,3 +132,28 @@ func MarkOnDeququq(o *Opts) QueueOptions {
 		return nil
 	}
 }
+
+// WithPriorityAging enables aging on priority queues. Every full interval an
+// item waits raises its effective priority by one. Intervals are rounded
+// down to whole milliseconds, with a minimum of one millisecond.
+func WithPriorityAging(interval time.Duration) QueueOptions {
+	return func(o *Opts) error {
+		if interval < 0 {
+			return fmt.Errorf("priority aging interval must not be negative: %v", interval)
+		}
+		o.PriorityAging = interval
+		return nil
+	}
+}
+
+// WithTTL sets the default time-to-live of enqueued items. Items that have
+// not been dequeued within their time-to-live expire.
+func WithTTL(ttl time.Duration) QueueOptions {
+	return func(o *Opts) error {
+		if ttl < 0 {
+			return fmt.Errorf("time-to-live must not be negative: %v", ttl)
+		}
+		o.TTL = ttl
+		return nil
+	}
+}
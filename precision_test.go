@@ -0,0 +1,101 @@
+package gopq_test
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestAckQueue_SubSecondAckTimeout(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: 200 * time.Millisecond})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(200*time.Millisecond), msg.AckDeadline, 100*time.Millisecond)
+
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+
+	time.Sleep(250 * time.Millisecond)
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(msg.Item))
+}
+
+func TestSimpleQueue_StrictFIFO(t *testing.T) {
+	q := setupTestQueue(t)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, q.Enqueue([]byte(fmt.Sprintf("item %d", i))))
+	}
+	for i := 0; i < 100; i++ {
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("item %d", i), string(msg.Item))
+	}
+}
+
+func TestAckQueue_MigratesSecondTimestamps(t *testing.T) {
+	tempFile := tempFilePath(t)
+
+	// Create a table with timestamps in seconds, as stored by earlier versions.
+	now := time.Now().Unix()
+	db, err := sql.Open("sqlite3", tempFile)
+	require.NoError(t, err)
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE ack_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			item BLOB NOT NULL,
+			enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			processed_at TIMESTAMP,
+			ack_deadline INTEGER,
+			retry_count INTEGER DEFAULT 0
+		);
+		INSERT INTO ack_queue (item, ack_deadline) VALUES ('in flight', %[1]d + 3600);
+		INSERT INTO ack_queue (item, ack_deadline) VALUES ('timed out', %[1]d - 10);
+		INSERT INTO ack_queue (item) VALUES ('pending');
+	`, now))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	q, err := gopq.NewAckQueue(tempFile, gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	defer q.Close()
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "timed out", string(msg.Item))
+	assert.WithinDuration(t, time.Now(), msg.EnqueuedAt, 5*time.Second)
+
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "pending", string(msg.Item))
+
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+	require.NoError(t, q.Ack(1))
+
+	// Opening the table again leaves the migrated timestamps alone.
+	require.NoError(t, q.Close())
+	q, err = gopq.NewAckQueue(tempFile, gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	defer q.Close()
+
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+
+	// The conversion is recorded, so it only runs once.
+	db, err = sql.Open("sqlite3", tempFile)
+	require.NoError(t, err)
+	defer db.Close()
+	var migrations int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM gopq_migrations WHERE table_name = 'ack_queue'").Scan(&migrations))
+	assert.Equal(t, 1, migrations)
+}
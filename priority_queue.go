@@ -0,0 +1,330 @@
+package gopq
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mattdeak/gopq/internal"
+)
+
+const (
+	priorityCreateTableQuery = `
+        CREATE TABLE IF NOT EXISTS %[1]s (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            item BLOB NOT NULL,
+            priority INTEGER NOT NULL DEFAULT 0,
+            enqueued_at INTEGER,
+            processed_at TIMESTAMP,
+            visible_at INTEGER,
+            attributes TEXT,
+            expires_at INTEGER,
+            codec TEXT
+        );
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_priority ON %[1]s(processed_at, priority);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_visible_at ON %[1]s(visible_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s(expires_at);
+    `
+	priorityEnqueueQuery = `
+        INSERT INTO %s (item, priority, expires_at, codec, enqueued_at) VALUES (?, ?, ?, ?, ?)
+    `
+	priorityTryDequeueQuery = `
+		WITH oldest AS (
+			SELECT id, item
+			FROM %[1]s
+			WHERE processed_at IS NULL AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY %[2]s, enqueued_at ASC, id ASC
+			LIMIT 1
+		)
+		UPDATE %[1]s
+		SET processed_at = datetime(?1 / 1000.0, 'unixepoch')
+		WHERE id = (SELECT id FROM oldest)
+		RETURNING id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
+    `
+
+	priorityTryDequeueBatchQuery = `
+		WITH batch AS MATERIALIZED (
+			SELECT id, row_number() OVER (ORDER BY %[2]s, enqueued_at ASC, id ASC) AS position
+			FROM %[1]s
+			WHERE processed_at IS NULL AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY %[2]s, enqueued_at ASC, id ASC
+			LIMIT ?2
+		)
+		UPDATE %[1]s
+		SET processed_at = datetime(?1 / 1000.0, 'unixepoch')
+		WHERE id IN (SELECT id FROM batch)
+		RETURNING (SELECT position FROM batch WHERE batch.id = %[1]s.id), id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
+    `
+
+	priorityAckCreateTableQuery = `
+        CREATE TABLE IF NOT EXISTS %[1]s (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            item BLOB NOT NULL,
+            priority INTEGER NOT NULL DEFAULT 0,
+            enqueued_at INTEGER,
+            processed_at TIMESTAMP,
+            ack_deadline INTEGER,
+            retry_count INTEGER DEFAULT 0,
+            visible_at INTEGER,
+            attributes TEXT,
+            expires_at INTEGER,
+            first_attempt_at INTEGER,
+            last_attempt_at INTEGER,
+            failures TEXT,
+            codec TEXT
+        );
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_priority ON %[1]s(processed_at, priority);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_ack_deadline ON %[1]s(ack_deadline);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_visible_at ON %[1]s(visible_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s(expires_at);
+    `
+	priorityAckTryDequeueQuery = `
+		WITH oldest AS (
+			SELECT id, item
+			FROM %[1]s
+			WHERE processed_at IS NULL AND (ack_deadline < ?1 OR ack_deadline IS NULL)
+				AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY %[2]s, enqueued_at ASC, id ASC
+			LIMIT 1
+		)
+		UPDATE %[1]s
+		SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1
+		WHERE id = (SELECT id FROM oldest)
+		RETURNING id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
+    `
+	priorityAckTryDequeueBatchQuery = `
+		WITH batch AS MATERIALIZED (
+			SELECT id, row_number() OVER (ORDER BY %[2]s, enqueued_at ASC, id ASC) AS position
+			FROM %[1]s
+			WHERE processed_at IS NULL AND (ack_deadline < ?1 OR ack_deadline IS NULL)
+				AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY %[2]s, enqueued_at ASC, id ASC
+			LIMIT ?3
+		)
+		UPDATE %[1]s
+		SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1
+		WHERE id IN (SELECT id FROM batch)
+		RETURNING (SELECT position FROM batch WHERE batch.id = %[1]s.id), id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
+    `
+)
+
+// priorityOrder returns the ORDER BY term used to pick the next item of a
+// priority queue. With aging enabled, every full aging interval an item has
+// waited raises its effective priority by one.
+func priorityOrder(aging time.Duration) string {
+	if aging <= 0 {
+		return "priority DESC"
+	}
+	millis := max(aging, time.Millisecond).Milliseconds()
+	return fmt.Sprintf("priority + (?1 - enqueued_at) / %d DESC", millis)
+}
+
+// NewPriorityQueue creates a new priority queue. Items with a higher priority
+// are dequeued first; items of equal priority are dequeued in FIFO order.
+// Items added with Enqueue have priority 0.
+// If filePath is empty, the queue will be created in memory.
+func NewPriorityQueue(filePath string, opts ...QueueOptions) (*Queue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create priority queue: %w", err)
+	}
+
+	db, err := internal.InitializeDB(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority queue: %w", err)
+	}
+
+	tableName := internal.DetermineTableName("priority_queue", filePath)
+	return newPriorityQueue(db, tableName, internal.MakeNotifyChan(), qo)
+}
+
+// newPriorityQueue creates a priority queue in the given table of db.
+func newPriorityQueue(db *sql.DB, tableName string, notifyChan chan struct{}, qo Opts) (*Queue, error) {
+	formattedCreateTableQuery := fmt.Sprintf(priorityCreateTableQuery, tableName)
+	formattedEnqueueQuery := fmt.Sprintf(simpleEnqueueQuery, tableName)
+	formattedEnqueuePriorityQuery := fmt.Sprintf(priorityEnqueueQuery, tableName)
+	formattedTryDequeueQuery := fmt.Sprintf(priorityTryDequeueQuery, tableName, priorityOrder(qo.PriorityAging))
+	formattedTryDequeueBatchQuery := fmt.Sprintf(priorityTryDequeueBatchQuery, tableName, priorityOrder(qo.PriorityAging))
+	formattedLenQuery := fmt.Sprintf(simpleLenQuery, tableName)
+	formattedEnqueueAtQuery := fmt.Sprintf(delayedEnqueueQuery, tableName)
+	formattedEnqueueAttributesQuery := fmt.Sprintf(attributesEnqueueQuery, tableName)
+	formattedNextVisibleQuery := fmt.Sprintf(delayedNextVisibleQuery, tableName)
+	formattedLenExpiredQuery := fmt.Sprintf(ttlLenExpiredQuery, tableName, expiredCondition)
+	formattedPurgeExpiredQuery := fmt.Sprintf(ttlPurgeExpiredQuery, tableName, expiredCondition)
+	order := priorityOrder(qo.PriorityAging) + ", " + fifoOrder
+	formattedPeekQuery := fmt.Sprintf(browseQuery, tableName, readyCondition, order)
+	formattedBrowseQuery := fmt.Sprintf(browseQuery, tableName, pendingCondition, order)
+	formattedDeleteByIDQuery := fmt.Sprintf(adminDeleteQuery, tableName)
+	formattedPurgePendingQuery := fmt.Sprintf(adminPurgeQuery, tableName, unprocessedFilter)
+	formattedPurgeAllQuery := fmt.Sprintf(adminPurgeQuery, tableName, "")
+	formattedRequeueQuery := fmt.Sprintf(adminRequeueQuery, tableName, requeueSet)
+	formattedCompactAgeQuery := fmt.Sprintf(compactAgeQuery, tableName)
+	formattedCompactCountQuery := fmt.Sprintf(compactCountQuery, tableName)
+
+	common, err := qo.CommonOpts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	err = internal.MigrateTable(db, tableName, addedColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority queue: %w", err)
+	}
+	err = internal.MigrateMillis(db, tableName, millisColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority queue: %w", err)
+	}
+
+	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedEnqueuePriorityQuery, formattedTryDequeueQuery, formattedTryDequeueBatchQuery, formattedLenQuery, formattedEnqueueAtQuery, formattedEnqueueAttributesQuery, formattedNextVisibleQuery, formattedLenExpiredQuery, formattedPurgeExpiredQuery, formattedPeekQuery, formattedBrowseQuery, formattedDeleteByIDQuery, formattedPurgePendingQuery, formattedPurgeAllQuery, formattedRequeueQuery, formattedCompactAgeQuery, formattedCompactCountQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority queue: %w", err)
+	}
+
+	q := &Queue{
+		db:           db,
+		name:         tableName,
+		pollInterval: defaultPollInterval,
+		notifyChan:   notifyChan,
+		queries: baseQueries{
+			enqueue:           formattedEnqueueQuery,
+			enqueuePriority:   formattedEnqueuePriorityQuery,
+			enqueueAt:         formattedEnqueueAtQuery,
+			enqueueAttributes: formattedEnqueueAttributesQuery,
+			tryDequeue:        formattedTryDequeueQuery,
+			tryDequeueBatch:   formattedTryDequeueBatchQuery,
+			len:               formattedLenQuery,
+			nextVisible:       formattedNextVisibleQuery,
+			lenExpired:        formattedLenExpiredQuery,
+			purgeExpired:      formattedPurgeExpiredQuery,
+			peek:              formattedPeekQuery,
+			browse:            formattedBrowseQuery,
+			deleteByID:        formattedDeleteByIDQuery,
+			purgePending:      formattedPurgePendingQuery,
+			purgeAll:          formattedPurgeAllQuery,
+			requeue:           formattedRequeueQuery,
+			compactAge:        formattedCompactAgeQuery,
+			compactCount:      formattedCompactCountQuery,
+			vacuum:            compactVacuumQuery,
+		},
+		opts: common,
+		mode: modeCodec,
+	}
+	q.startJanitor()
+	return q, nil
+}
+
+// NewPriorityAckQueue creates a new priority queue with acknowledgement
+// support. Items with a higher priority are dequeued first; items of equal
+// priority are dequeued in FIFO order.
+// If filePath is empty, the queue will be created in memory.
+func NewPriorityAckQueue(filePath string, ackOpts AckOpts, opts ...QueueOptions) (*AcknowledgeableQueue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create priority ack queue: %w", err)
+	}
+
+	db, err := internal.InitializeDB(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority ack queue: %w", err)
+	}
+
+	tableName := internal.DetermineTableName("priority_ack_queue", filePath)
+	return newPriorityAckQueue(db, tableName, internal.MakeNotifyChan(), ackOpts, qo)
+}
+
+// newPriorityAckQueue creates a priority ack queue in the given table of db.
+func newPriorityAckQueue(db *sql.DB, tableName string, notifyChan chan struct{}, ackOpts AckOpts, qo Opts) (*AcknowledgeableQueue, error) {
+	formattedCreateTableQuery := fmt.Sprintf(priorityAckCreateTableQuery, tableName)
+	formattedEnqueueQuery := fmt.Sprintf(ackEnqueueQuery, tableName)
+	formattedEnqueuePriorityQuery := fmt.Sprintf(priorityEnqueueQuery, tableName)
+	formattedTryDequeueQuery := fmt.Sprintf(priorityAckTryDequeueQuery, tableName, priorityOrder(qo.PriorityAging))
+	formattedTryDequeueBatchQuery := fmt.Sprintf(priorityAckTryDequeueBatchQuery, tableName, priorityOrder(qo.PriorityAging))
+	formattedAckQuery := fmt.Sprintf(ackAckActs[ackOpts.AckAction], tableName)
+	formattedLenQuery := fmt.Sprintf(ackLenQuery, tableName)
+	formattedEnqueueAtQuery := fmt.Sprintf(delayedEnqueueQuery, tableName)
+	formattedEnqueueAttributesQuery := fmt.Sprintf(attributesEnqueueQuery, tableName)
+	formattedNextVisibleQuery := fmt.Sprintf(delayedNextVisibleQuery, tableName)
+	formattedLenExpiredQuery := fmt.Sprintf(ttlLenExpiredQuery, tableName, ackExpiredCondition)
+	formattedSelectExpiredQuery := fmt.Sprintf(ttlAckSelectExpiredQuery, tableName, ackExpiredCondition)
+	formattedPurgeExpiredQuery := fmt.Sprintf(ttlAckPurgeExpiredQuery, tableName, ackExpiredCondition)
+	order := priorityOrder(qo.PriorityAging) + ", " + fifoOrder
+	formattedPeekQuery := fmt.Sprintf(browseAckQuery, tableName, ackReadyCondition, order)
+	formattedBrowseQuery := fmt.Sprintf(browseAckQuery, tableName, pendingCondition, order)
+	formattedDeleteByIDQuery := fmt.Sprintf(adminDeleteQuery, tableName)
+	formattedPurgePendingQuery := fmt.Sprintf(adminPurgeQuery, tableName, unprocessedFilter)
+	formattedPurgeAllQuery := fmt.Sprintf(adminPurgeQuery, tableName, "")
+	formattedRequeueQuery := fmt.Sprintf(adminRequeueQuery, tableName, ackRequeueSet)
+	formattedCompactAgeQuery := fmt.Sprintf(compactAgeQuery, tableName)
+	formattedCompactCountQuery := fmt.Sprintf(compactCountQuery, tableName)
+
+	common, err := ackOpts.CommonOpts.or(qo.CommonOpts).resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	err = internal.MigrateTable(db, tableName, ackAddedColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority ack queue: %w", err)
+	}
+	err = internal.MigrateMillis(db, tableName, millisColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority ack queue: %w", err)
+	}
+
+	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedEnqueuePriorityQuery, formattedTryDequeueQuery, formattedTryDequeueBatchQuery, formattedAckQuery, formattedLenQuery, formattedEnqueueAtQuery, formattedEnqueueAttributesQuery, formattedNextVisibleQuery, formattedLenExpiredQuery, formattedSelectExpiredQuery, formattedPurgeExpiredQuery, formattedPeekQuery, formattedBrowseQuery, formattedDeleteByIDQuery, formattedPurgePendingQuery, formattedPurgeAllQuery, formattedRequeueQuery, formattedCompactAgeQuery, formattedCompactCountQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority ack queue: %w", err)
+	}
+
+	q := &AcknowledgeableQueue{
+		Queue: Queue{
+			db:           db,
+			name:         tableName,
+			pollInterval: defaultPollInterval,
+			notifyChan:   notifyChan,
+			queries: baseQueries{
+				enqueue:           formattedEnqueueQuery,
+				enqueuePriority:   formattedEnqueuePriorityQuery,
+				enqueueAt:         formattedEnqueueAtQuery,
+				enqueueAttributes: formattedEnqueueAttributesQuery,
+				tryDequeue:        formattedTryDequeueQuery,
+				tryDequeueBatch:   formattedTryDequeueBatchQuery,
+				len:               formattedLenQuery,
+				nextVisible:       formattedNextVisibleQuery,
+				lenExpired:        formattedLenExpiredQuery,
+				selectExpired:     formattedSelectExpiredQuery,
+				purgeExpired:      formattedPurgeExpiredQuery,
+				peek:              formattedPeekQuery,
+				browse:            formattedBrowseQuery,
+				deleteByID:        formattedDeleteByIDQuery,
+				purgePending:      formattedPurgePendingQuery,
+				purgeAll:          formattedPurgeAllQuery,
+				requeue:           formattedRequeueQuery,
+				compactAge:        formattedCompactAgeQuery,
+				compactCount:      formattedCompactCountQuery,
+				vacuum:            compactVacuumQuery,
+			},
+			opts: common,
+			mode: modeCodec,
+		},
+		AckOpts: ackOpts,
+		ackQueries: ackQueries{
+			ack: formattedAckQuery,
+			ackUtilsQueries: ackUtilsQueries{
+				details:       fmt.Sprintf(sqlite.details, tableName),
+				delete:        fmt.Sprintf(sqlite.delete, tableName),
+				forRetry:      fmt.Sprintf(sqlite.forRetry, tableName),
+				expire:        fmt.Sprintf(sqlite.expire, tableName),
+				extend:        fmt.Sprintf(sqlite.extend, tableName),
+				recordFailure: fmt.Sprintf(sqlite.recordFailure, tableName),
+			},
+		},
+	}
+	q.onExpired = q.runExpiredCallback
+	q.startJanitor()
+	return q, nil
+}
@@ -0,0 +1,170 @@
+package gopq_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestNewPriorityQueue(t *testing.T) {
+	tempFile := tempFilePath(t)
+	defer os.Remove(tempFile)
+
+	q, err := gopq.NewPriorityQueue(tempFile)
+	if err != nil {
+		t.Fatalf("NewPriorityQueue() error = %v", err)
+	}
+	if q == nil {
+		t.Fatal("NewPriorityQueue() returned nil")
+	}
+}
+
+func TestPriorityQueue_DequeueOrder(t *testing.T) {
+	q := setupTestPriorityQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("default")))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("low"), -1))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("high-1"), 10))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("high-2"), 10))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("medium"), 5))
+
+	for _, expected := range []string{"high-1", "high-2", "medium", "default", "low"} {
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(msg.Item))
+	}
+
+	_, err := q.TryDequeue()
+	assert.Error(t, err)
+}
+
+func TestPriorityQueue_Len(t *testing.T) {
+	q := setupTestPriorityQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("item1"), 1))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("item2"), 2))
+
+	count, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = q.TryDequeue()
+	require.NoError(t, err)
+
+	count, err = q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestPriorityQueue_Aging(t *testing.T) {
+	tempFile := tempFilePath(t)
+	q, err := gopq.NewPriorityQueue(tempFile, gopq.WithPriorityAging(time.Second))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("old"), 0))
+	time.Sleep(1100 * time.Millisecond)
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("new"), 1))
+
+	// The old item has aged up to the priority of the new one and
+	// wins the tie by being enqueued first.
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(msg.Item))
+}
+
+func TestPriorityQueue_NegativeAging(t *testing.T) {
+	_, err := gopq.NewPriorityQueue("", gopq.WithPriorityAging(-time.Second))
+	assert.Error(t, err)
+}
+
+func TestPriorityAckQueue_DequeueOrder(t *testing.T) {
+	tempFile := tempFilePath(t)
+	q, err := gopq.NewPriorityAckQueue(tempFile, gopq.AckOpts{AckTimeout: time.Hour})
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("low"), 1))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("high"), 2))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "high", string(msg.Item))
+
+	// An unacked item is not handed out again until its deadline expires.
+	require.NoError(t, q.ExpireAck(msg.ID))
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "high", string(msg.Item))
+	require.NoError(t, q.Ack(msg.ID))
+
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "low", string(msg.Item))
+}
+
+func TestPriorityQueue_DequeueBatchOrder(t *testing.T) {
+	q := setupTestPriorityQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("low"), -1))
+	require.NoError(t, q.Enqueue([]byte("default")))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("high-1"), 10))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("medium"), 5))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("high-2"), 10))
+
+	// Batches keep the dequeue order rather than the insertion order.
+	msgs, err := q.TryDequeueBatch(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"high-1", "high-2", "medium"}, items(msgs))
+
+	msgs, err = q.TryDequeueBatch(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "low"}, items(msgs))
+}
+
+func TestPriorityAckQueue_DequeueBatchOrder(t *testing.T) {
+	tempFile := tempFilePath(t)
+	q, err := gopq.NewPriorityAckQueue(tempFile, gopq.AckOpts{AckTimeout: time.Hour})
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("low"), 1))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("medium"), 2))
+	require.NoError(t, q.EnqueuePriority(ctx, []byte("high"), 3))
+
+	msgs, err := q.DequeueBatch(ctx, 3, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"high", "medium", "low"}, items(msgs))
+}
+
+func TestSimpleQueue_EnqueuePriorityUnsupported(t *testing.T) {
+	q := setupTestQueue(t)
+
+	err := q.EnqueuePriority(context.Background(), []byte("item"), 1)
+	var unsupported *gopq.ErrUnsupported
+	assert.ErrorAs(t, err, &unsupported)
+}
+
+func setupTestPriorityQueue(t *testing.T) *gopq.Queue {
+	tempFile := tempFilePath(t)
+	t.Cleanup(func() { os.Remove(tempFile) })
+
+	q, err := gopq.NewPriorityQueue(tempFile)
+	if err != nil {
+		t.Fatalf("Failed to create test queue: %v", err)
+	}
+	return q
+}
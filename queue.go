@@ -3,8 +3,10 @@ package gopq
 import (
 	"context"
 	"database/sql"
+	"sync/atomic"
 	"time"
 
+	"github.com/mattdeak/gopq/internal"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -76,15 +78,83 @@ type Msg struct {
 
 	// Item contains the actual message data.
 	Item []byte
+
+	// Attributes contains metadata stored alongside the item, such as a
+	// content type or trace ID. It is nil if the message has none.
+	Attributes map[string]string
+
+	// EnqueuedAt is the time the message was enqueued.
+	EnqueuedAt time.Time
+
+	// RetryCount is the number of times the message has been nacked so far.
+	// It is only set by acknowledgeable queues.
+	RetryCount int
+
+	// AckDeadline is the deadline for acknowledging the message, as set by
+	// the dequeue operation. It is only set by acknowledgeable queues.
+	AckDeadline time.Time
 }
 
 // Queue represents the basic queue structure.
 // It contains the database connection, queue name, and other necessary fields for queue operations.
 type Queue struct {
 	db           *sql.DB
+	name         string
 	pollInterval time.Duration
 	notifyChan   chan struct{}
 	queries      baseQueries
+
+	// opts are the resolved settings of the queue. Their Clock is never
+	// nil, and their Retention includes the dedupe window of unique queues.
+	opts CommonOpts
+
+	// mode describes how the queue stores its items.
+	mode queueMode
+
+	// onExpired is called with each expired item before it is purged, and
+	// janitor purges them and enforces the retention policy in the
+	// background.
+	onExpired func(msg Msg) error
+	janitor   *janitor
+
+	// scheduled counts the items this queue enqueued with a visibility
+	// time, and unscheduledAt is one more than that count when the queue
+	// last found no scheduled item, so that blocking dequeues only look for
+	// the next visible item when there may be one.
+	scheduled     atomic.Int64
+	unscheduledAt atomic.Int64
+}
+
+// queueMode is a set of flags describing how a queue stores its items.
+type queueMode uint8
+
+const (
+	// modeKeyed is set for unique queues, whose enqueue queries take the
+	// deduplication key as their last argument.
+	modeKeyed queueMode = 1 << iota
+
+	// modeCodec is set for queues that record the codec of their items,
+	// whose enqueue queries end with it and the enqueue time.
+	modeCodec
+
+	// modeExternal is set for queues on an external database, whose
+	// procedures may omit trailing columns of the rows they return and
+	// store no codec.
+	modeExternal
+
+	// modeDBClock is set for external queues whose dequeue and length
+	// procedures read the current time from the database instead of taking
+	// it as an argument.
+	modeDBClock
+
+	// modeShared is set for queues handed out by a Broker or a Topic,
+	// which owns the database connection.
+	modeShared
+)
+
+// is reports whether all flags of mode are set.
+func (m queueMode) is(mode queueMode) bool {
+	return m&mode == mode
 }
 
 type AcknowledgeableQueue struct {
@@ -93,10 +163,60 @@ type AcknowledgeableQueue struct {
 	ackQueries ackQueries
 }
 
+// addedColumns are added to queue tables created by earlier versions.
+var addedColumns = []internal.Column{
+	{Name: "visible_at", Definition: "INTEGER"},
+	{Name: "attributes", Definition: "TEXT"},
+	{Name: "expires_at", Definition: "INTEGER"},
+	{Name: "codec", Definition: "TEXT"},
+}
+
+// deadLetterColumns record the delivery history of messages in the tables
+// of acknowledgeable queues, and ackAddedColumns are all columns added to
+// such tables by later versions.
+var (
+	deadLetterColumns = []internal.Column{
+		{Name: "first_attempt_at", Definition: "INTEGER"},
+		{Name: "last_attempt_at", Definition: "INTEGER"},
+		{Name: "failures", Definition: "TEXT"},
+	}
+	ackAddedColumns = append(append([]internal.Column{}, addedColumns...), deadLetterColumns...)
+)
+
+// processedColumn is added to the tables of unique queues, which only mark
+// items as processed if they remember them for their lifetime.
+var (
+	processedColumn       = internal.Column{Name: "processed_at", Definition: "TIMESTAMP"}
+	uniqueAddedColumns    = append(append([]internal.Column{}, addedColumns...), processedColumn)
+	uniqueAckAddedColumns = append(append([]internal.Column{}, ackAddedColumns...), processedColumn)
+)
+
+// millisColumns hold timestamps in Unix milliseconds. Earlier versions
+// stored them in Unix seconds or, for enqueued_at, as TIMESTAMP text.
+var millisColumns = []string{"enqueued_at", "visible_at", "expires_at", "ack_deadline"}
+
 type baseQueries struct {
-	enqueue    string
-	tryDequeue string
-	len        string
+	enqueue           string
+	enqueuePriority   string
+	enqueueAt         string
+	enqueueAttributes string
+	tryDequeue        string
+	tryDequeueBatch   string
+	len               string
+	nextVisible       string
+	lenExpired        string
+	selectExpired     string
+	purgeExpired      string
+	peek              string
+	browse            string
+	deleteByID        string
+	purgePending      string
+	purgeAll          string
+	requeue           string
+	compactAge        string
+	compactCount      string
+	compactOrphans    string
+	vacuum            string
 }
 
 type ackUtilsQueries struct {
@@ -104,6 +224,10 @@ type ackUtilsQueries struct {
 	delete   string
 	forRetry string
 	expire   string
+	extend   string
+
+	// recordFailure adds a failure reason to the history of a message.
+	recordFailure string
 }
 
 type ackQueries struct {
@@ -113,7 +237,15 @@ type ackQueries struct {
 
 // Close closes the database connection associated with the queue.
 // It should be called when the queue is no longer needed to free up resources.
+// Queues handed out by a Broker share its connection, which stays open until
+// the Broker is closed.
 func (q *Queue) Close() error {
+	if q.janitor != nil {
+		q.janitor.close()
+	}
+	if q.mode.is(modeShared) {
+		return nil
+	}
 	return q.db.Close()
 }
 
@@ -139,17 +271,96 @@ func (q *Queue) TryEnqueue(item []byte) error {
 // TryEnqueueCtx attempts to add an item to the queue.
 // This is non-blocking, and will return immediately.
 func (q *Queue) TryEnqueueCtx(ctx context.Context, item []byte) error {
-	_, err := q.db.ExecContext(ctx, q.queries.enqueue, item)
+	if q.queries.enqueue == "" {
+		return &ErrUnsupported{Op: "Enqueue"}
+	}
+	return q.tryEnqueue(ctx, q.queries.enqueue, item, q.expiresAt(q.opts.TTL))
+}
+
+// EnqueuePriority adds an item with the given priority to the queue.
+// Items with a higher priority are dequeued first.
+// Only queues created with NewPriorityQueue or NewPriorityAckQueue
+// support priorities; other queues return ErrUnsupported.
+func (q *Queue) EnqueuePriority(ctx context.Context, item []byte, priority int) error {
+	return retryWhileLocked(ctx, defaultPollInterval, func(ctx context.Context) error {
+		return q.TryEnqueuePriority(ctx, item, priority)
+	})
+}
+
+// TryEnqueuePriority attempts to add an item with the given priority to the queue.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryEnqueuePriority(ctx context.Context, item []byte, priority int) error {
+	if q.queries.enqueuePriority == "" {
+		return &ErrUnsupported{Op: "EnqueuePriority"}
+	}
+	return q.tryEnqueue(ctx, q.queries.enqueuePriority, item, priority, q.expiresAt(q.opts.TTL))
+}
+
+// tryEnqueue runs an enqueue query for item and wakes up a waiting dequeuer.
+func (q *Queue) tryEnqueue(ctx context.Context, query string, item []byte, args ...any) error {
+	all, err := q.enqueueArgs(item, args...)
+	if err != nil {
+		return err
+	}
+	return q.execEnqueue(ctx, query, all...)
+}
+
+// execEnqueue runs an enqueue query with the given arguments and wakes up a
+// waiting dequeuer.
+func (q *Queue) execEnqueue(ctx context.Context, query string, args ...any) error {
+	if !q.mode.is(modeKeyed) {
+		_, err := q.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return handleEnqueueResult(err)
+		}
+		q.enqueued(query)
+		return nil
+	}
+
+	if err := q.purgeExpiredFirst(ctx); err != nil {
+		return err
+	}
+	tx, err := q.db.BeginTx(ctx, nil)
 	if err != nil {
 		return handleEnqueueResult(err)
 	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
 
-	// Send a notification to the channel to wake up the dequeueing goroutine.
+	err = q.purgeExpiredTx(ctx, tx)
+	if err != nil {
+		return handleEnqueueResult(err)
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return handleEnqueueResult(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return handleEnqueueResult(err)
+	}
+
+	q.enqueued(query)
+	return nil
+}
+
+// enqueued records that an item was added with query and wakes up a
+// waiting dequeuer. Scheduled items are counted before the dequeuer wakes
+// up, so that it looks for the next visible item.
+func (q *Queue) enqueued(query string) {
+	if query == q.queries.enqueueAt {
+		q.scheduled.Add(1)
+	}
+	q.notify()
+}
+
+// notify wakes up a dequeueing goroutine waiting for new items.
+func (q *Queue) notify() {
 	select {
 	case q.notifyChan <- struct{}{}:
 	default:
 	}
-	return nil
 }
 
 // Dequeue blocks until an item is available. Uses background context.
@@ -173,26 +384,17 @@ func (q *Queue) TryDequeue() (Msg, error) {
 // TryDequeueCtx attempts to remove and return the next item from the queue.
 // This is non-blocking, and will return immediately.
 func (q *Queue) TryDequeueCtx(ctx context.Context) (Msg, error) {
-	row := q.db.QueryRowContext(ctx, q.queries.tryDequeue)
-	var id int64
-	var item []byte
-	err := row.Scan(&id, &item)
-	return handleDequeueResult(id, item, err)
+	rows, err := q.db.QueryContext(ctx, q.queries.tryDequeue, q.nowArgs()...)
+	return q.handleDequeueResult(rows, err)
 }
 
 // Len returns the number of items in the queue.
+// Items that are not visible yet, either because they are scheduled for
+// later or are waiting for an acknowledgement, are not counted. Neither
+// are expired items, see LenExpired.
 // It returns the count and any error encountered during the operation.
 func (q *Queue) Len() (int, error) {
-	row := q.db.QueryRow(q.queries.len)
-	var count int
-	err := row.Scan(&count)
-	return count, err
-}
-
-// Len returns the number of items in the queue.
-// It returns the count and any error encountered during the operation.
-func (q *AcknowledgeableQueue) Len() (int, error) {
-	row := q.db.QueryRow(q.queries.len, q.now())
+	row := q.db.QueryRow(q.queries.len, q.nowArgs()...)
 	var count int
 	err := row.Scan(&count)
 	return count, err
@@ -231,14 +433,14 @@ func (q *AcknowledgeableQueue) AckCtx(ctx context.Context, id int64) error {
 // It takes the ID of the message to negative acknowledge.
 // This is non-blocking, and will return immediately.
 func (q *AcknowledgeableQueue) TryNack(id int64) error {
-	return q.ackQueries.nackImpl(context.Background(), q.db, id, q.AckOpts)
+	return q.nack(context.Background(), id, q.AckOpts.retryDelay, "")
 }
 
 // TryNackCtx indicates that an item processing has failed and should be requeued.
 // It takes the ID of the message to negative acknowledge.
 // This is non-blocking, and will return immediately.
 func (q *AcknowledgeableQueue) TryNackCtx(ctx context.Context, id int64) error {
-	return q.ackQueries.nackImpl(ctx, q.db, id, q.AckOpts)
+	return q.nack(ctx, id, q.AckOpts.retryDelay, "")
 }
 
 // Nack indicates that an item processing has failed and should be requeued.
@@ -279,12 +481,9 @@ func (q *AcknowledgeableQueue) TryDequeue() (Msg, error) {
 // TryDequeueCtx attempts to remove and return the next item from the queue.
 // It returns immediately if an item is available, or waits until the context is cancelled.
 func (q *AcknowledgeableQueue) TryDequeueCtx(ctx context.Context) (Msg, error) {
-	ackDeadline := time.Now().Add(q.AckOpts.AckTimeout).Unix()
-	row := q.db.QueryRowContext(ctx, q.queries.tryDequeue, q.now(), ackDeadline)
-	var id int64
-	var item []byte
-	err := row.Scan(&id, &item)
-	return handleDequeueResult(id, item, err)
+	ackDeadline := q.opts.Clock.Now().Add(q.AckOpts.AckTimeout).UnixMilli()
+	rows, err := q.db.QueryContext(ctx, q.queries.tryDequeue, q.now(), ackDeadline)
+	return q.handleDequeueResult(rows, err)
 }
 
 // ExpireAck expires the acknowledgement deadline for an item,
@@ -292,7 +491,7 @@ func (q *AcknowledgeableQueue) TryDequeueCtx(ctx context.Context) (Msg, error) {
 // It takes the ID of the message to expire the acknowledgement deadline for.
 // Returns an error if the operation fails or the message doesn't exist.
 func (q *AcknowledgeableQueue) ExpireAck(id int64) error {
-	return q.ackQueries.expireAckDeadline(q.db, id)
+	return q.ackQueries.expireAckDeadline(q.db, id, q.opts.Clock.Now())
 }
 
 // SetBehaviourOnFailure sets the behaviour on failure for the queue.
@@ -305,5 +504,14 @@ func (q *AcknowledgeableQueue) RegisterBehaviourOnFailure(fn func(msg Msg) error
 }
 
 func (q *Queue) now() int64 {
-	return time.Now().Unix()
+	return q.opts.Clock.Now().UnixMilli()
+}
+
+// nowArgs returns the arguments of the dequeue and length queries: the
+// current time, unless the database reads it itself.
+func (q *Queue) nowArgs() []any {
+	if q.mode.is(modeDBClock) {
+		return nil
+	}
+	return []any{q.now()}
 }
@@ -0,0 +1,171 @@
+package gopq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// redrivePageSize is the number of dead letters read at a time by Redrive.
+const redrivePageSize = 100
+
+// RedriveOpts controls how Redrive moves messages.
+type RedriveOpts struct {
+	// Rate is the maximum number of messages moved per second. Zero means
+	// no limit.
+	Rate int
+
+	// DryRun only counts the messages that would be moved.
+	DryRun bool
+}
+
+// Redrive moves the messages of the dead letter queue from that match
+// filter back into the queue to, in the order they were dead lettered, and
+// returns how many were moved. A nil filter matches all messages.
+//
+// Moved messages keep their attributes, except the dead letter record
+// added by RegisterDeadLetterQueue, and start over with a retry count of
+// zero. The filter is called with the dead letter record if the message
+// has one, and with just the message otherwise.
+//
+// If both queues share a database, such as queues of one Broker, each
+// message is moved in a single transaction. Otherwise it is enqueued before
+// it is deleted, so a crash may deliver a message twice but never loses it.
+func Redrive(ctx context.Context, from *Queue, to *AcknowledgeableQueue, filter func(dl DeadLetter) bool, opts RedriveOpts) (int, error) {
+	if opts.Rate < 0 {
+		return 0, fmt.Errorf("redrive rate must not be negative: %d", opts.Rate)
+	}
+	if from.queries.deleteByID == "" || to.queries.enqueueAttributes == "" {
+		return 0, &ErrUnsupported{Op: "Redrive"}
+	}
+
+	var tick <-chan time.Time
+	if interval := rateInterval(opts.Rate); interval > 0 && !opts.DryRun {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	moved := 0
+	skipped := 0
+	for {
+		msgs, err := from.Browse(ctx, skipped, redrivePageSize)
+		if err != nil {
+			return moved, err
+		}
+		if len(msgs) == 0 {
+			return moved, nil
+		}
+
+		for _, msg := range msgs {
+			dl, err := ParseDeadLetter(msg)
+			if err != nil {
+				dl = DeadLetter{Msg: msg}
+			}
+			if filter != nil && !filter(dl) {
+				skipped++
+				continue
+			}
+			if opts.DryRun {
+				moved++
+				skipped++
+				continue
+			}
+
+			if tick != nil && moved > 0 {
+				select {
+				case <-ctx.Done():
+					return moved, ctx.Err()
+				case <-tick:
+				}
+			}
+			if err := redriveMsg(ctx, from, to, msg); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+}
+
+// redriveMsg moves a single message from a dead letter queue into to.
+func redriveMsg(ctx context.Context, from *Queue, to *AcknowledgeableQueue, msg Msg) error {
+	encoded, err := encodeAttributes(stripDeadLetter(msg.Attributes))
+	if err != nil {
+		return err
+	}
+
+	if from.db != to.db {
+		err := retryWhileLocked(ctx, to.pollInterval, func(ctx context.Context) error {
+			return to.tryEnqueue(ctx, to.queries.enqueueAttributes, msg.Item, encoded, to.expiresAt(to.opts.TTL))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to redrive message %d: %w", msg.ID, err)
+		}
+		return from.DeleteByID(ctx, msg.ID)
+	}
+
+	if err := to.purgeExpiredFirst(ctx); err != nil {
+		return fmt.Errorf("failed to redrive message %d: %w", msg.ID, err)
+	}
+	err = retryWhileLocked(ctx, to.pollInterval, func(ctx context.Context) error {
+		tx, err := to.db.BeginTx(ctx, nil)
+		if err != nil {
+			return handleLockedResult(err)
+		}
+		defer func() {
+			_ = tx.Rollback() // will fail if committed, but that's fine
+		}()
+
+		res, err := tx.ExecContext(ctx, from.queries.deleteByID, msg.ID)
+		if err != nil {
+			return handleLockedResult(err)
+		}
+		if err := checkFound(res.RowsAffected, msg.ID); err != nil {
+			return err
+		}
+		err = to.purgeExpiredTx(ctx, tx)
+		if err != nil {
+			return handleLockedResult(err)
+		}
+		args, err := to.enqueueArgs(msg.Item, encoded, to.expiresAt(to.opts.TTL))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, to.queries.enqueueAttributes, args...)
+		if err != nil {
+			return handleLockedResult(err)
+		}
+		return handleLockedResult(tx.Commit())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to redrive message %d: %w", msg.ID, err)
+	}
+	to.notify()
+	return nil
+}
+
+// rateInterval returns the time between two messages moved at the given
+// rate, or zero if the rate is too high to pace.
+func rateInterval(rate int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Second / time.Duration(rate)
+}
+
+// stripDeadLetter returns attributes without the dead letter record, or nil
+// if no other attributes remain.
+func stripDeadLetter(attributes map[string]string) map[string]string {
+	var stripped map[string]string
+	for k, v := range attributes {
+		if strings.HasPrefix(k, deadLetterAttributePrefix) {
+			continue
+		}
+		if stripped == nil {
+			stripped = map[string]string{}
+		}
+		stripped[k] = v
+	}
+	return stripped
+}
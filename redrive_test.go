@@ -0,0 +1,75 @@
+package gopq_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func TestRedrive(t *testing.T) {
+	b, err := gopq.NewBroker(tempFilePath(t))
+	require.NoError(t, err)
+	defer b.Close()
+
+	q, err := b.AckQueue("jobs", gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	require.NoError(t, err)
+	dlq, err := b.SimpleQueue("jobs_dlq")
+	require.NoError(t, err)
+	q.RegisterDeadLetterQueue(dlq)
+
+	ctx := context.Background()
+	for i, reason := range []string{"bug A", "bug B", "bug A"} {
+		item := []byte{byte('a' + i)}
+		require.NoError(t, q.EnqueueWithAttributes(ctx, item, map[string]string{"trace-id": string(item)}))
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		require.NoError(t, q.NackWithReason(ctx, msg.ID, errors.New(reason)))
+	}
+
+	bugA := func(dl gopq.DeadLetter) bool { return dl.LastError == "bug A" }
+	n, err := gopq.Redrive(ctx, dlq, q, bugA, gopq.RedriveOpts{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assertQueueLen(t, dlq, 3)
+
+	n, err = gopq.Redrive(ctx, dlq, q, bugA, gopq.RedriveOpts{Rate: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assertQueueLen(t, dlq, 1)
+
+	for _, want := range []string{"a", "c"} {
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(msg.Item))
+		assert.Equal(t, map[string]string{"trace-id": want}, msg.Attributes)
+		assert.Equal(t, 0, msg.RetryCount)
+	}
+
+	_, err = gopq.Redrive(ctx, dlq, q, nil, gopq.RedriveOpts{Rate: -1})
+	assert.Error(t, err)
+}
+
+func TestRedrive_SeparateDatabases(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute})
+	dlq := setupTestQueue(t)
+	ctx := context.Background()
+
+	// Dead letter queues filled by other means are redriven as well.
+	require.NoError(t, dlq.Enqueue([]byte("first")))
+	require.NoError(t, dlq.Enqueue([]byte("second")))
+
+	n, err := gopq.Redrive(ctx, dlq, q, nil, gopq.RedriveOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assertQueueLen(t, dlq, 0)
+
+	msgs, err := q.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, items(msgs))
+}
@@ -0,0 +1,209 @@
+package gopq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultJanitorInterval is how often a retention policy is enforced, and
+// expired items are purged, if the policy does not set an interval.
+const defaultJanitorInterval = time.Minute
+
+const (
+	// processed_at holds the datetime text of the clock time an item was
+	// processed, which sorts like the datetime of the cutoff.
+	compactAgeQuery = `
+        DELETE FROM %[1]s
+        WHERE processed_at < datetime(?1 / 1000.0, 'unixepoch')
+    `
+	compactCountQuery = `
+        DELETE FROM %[1]s
+        WHERE processed_at IS NOT NULL AND id NOT IN (
+            SELECT id FROM %[1]s WHERE processed_at IS NOT NULL
+            ORDER BY processed_at DESC, id DESC
+            LIMIT ?1
+        )
+    `
+	compactVacuumQuery = "PRAGMA incremental_vacuum"
+)
+
+// RetentionPolicy limits how many processed items a queue keeps. Queues
+// that mark items as processed instead of deleting them, which is the
+// default, otherwise keep them forever.
+type RetentionPolicy struct {
+	// MaxAge is how long processed items are kept. Zero keeps them
+	// regardless of their age.
+	MaxAge time.Duration
+
+	// MaxProcessed is how many of the most recently processed items are
+	// kept. Zero keeps them regardless of their number.
+	MaxProcessed int
+
+	// Interval is how often the policy is enforced, and expired items
+	// are purged, in the background. Defaults to one minute. It is
+	// measured in real time, not by the queue's Clock.
+	Interval time.Duration
+
+	// Vacuum returns the freed pages to the file system after deleting
+	// processed items. It only has an effect on databases created with
+	// incremental auto vacuum, which gopq enables for new database files.
+	Vacuum bool
+}
+
+// enabled reports whether the policy limits the processed items at all.
+func (p RetentionPolicy) enabled() bool {
+	return p.MaxAge > 0 || p.MaxProcessed > 0
+}
+
+// validate checks the policy for negative limits.
+func (p RetentionPolicy) validate() error {
+	if p.MaxAge < 0 || p.MaxProcessed < 0 || p.Interval < 0 {
+		return fmt.Errorf("retention limits must not be negative: %+v", p)
+	}
+	return nil
+}
+
+// WithRetention sets the retention policy for processed items. The queue
+// enforces it in the background until it is closed.
+func WithRetention(policy RetentionPolicy) QueueOptions {
+	return func(o *Opts) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		o.Retention = policy
+		return nil
+	}
+}
+
+// WithBackgroundErrorHandler sets the function called with the errors of
+// the work a queue does in the background, such as purging expired items and
+// enforcing the retention policy.
+func WithBackgroundErrorHandler(fn func(err error)) QueueOptions {
+	return func(o *Opts) error {
+		o.OnBackgroundError = fn
+		return nil
+	}
+}
+
+// Compact deletes processed items as the queue's retention policy allows
+// and returns how many were deleted. Without a retention policy, it deletes
+// all processed items. Pending items are never deleted. If the policy sets
+// Vacuum, the freed pages are returned to the file system afterwards.
+func (q *Queue) Compact(ctx context.Context) (int, error) {
+	if q.queries.vacuum == "" {
+		return 0, &ErrUnsupported{Op: "Compact"}
+	}
+
+	var deleted int64
+	deleteRows := func(query string, args ...any) error {
+		if query == "" {
+			return nil
+		}
+		res, err := q.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to compact queue: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to compact queue: %w", err)
+		}
+		deleted += n
+		return nil
+	}
+
+	policy := q.opts.Retention
+	if !policy.enabled() {
+		if err := deleteRows(q.queries.compactCount, 0); err != nil {
+			return 0, err
+		}
+	}
+	if policy.MaxAge > 0 {
+		cutoff := q.opts.Clock.Now().Add(-policy.MaxAge).UnixMilli()
+		if err := deleteRows(q.queries.compactAge, cutoff); err != nil {
+			return int(deleted), err
+		}
+	}
+	if policy.MaxProcessed > 0 {
+		if err := deleteRows(q.queries.compactCount, policy.MaxProcessed); err != nil {
+			return int(deleted), err
+		}
+	}
+
+	// Topics keep the payload of an item until no consumer group refers
+	// to it any more.
+	if err := deleteRows(q.queries.compactOrphans); err != nil {
+		return int(deleted), err
+	}
+
+	if policy.Vacuum {
+		if _, err := q.db.ExecContext(ctx, q.queries.vacuum); err != nil {
+			return int(deleted), fmt.Errorf("failed to vacuum database: %w", err)
+		}
+	}
+	return int(deleted), nil
+}
+
+// janitor enforces the retention policy of a queue and purges its expired
+// items in the background.
+type janitor struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// startJanitor starts enforcing the queue's retention policy and purging
+// its expired items until the queue is closed. Queues without a default
+// time-to-live or a retention policy, which includes the dedupe window of
+// unique queues, have no janitor.
+func (q *Queue) startJanitor() {
+	if q.queries.vacuum == "" || (q.opts.TTL <= 0 && !q.opts.Retention.enabled()) {
+		return
+	}
+	interval := q.opts.Retention.Interval
+	if interval == 0 {
+		interval = defaultJanitorInterval
+	}
+
+	j := &janitor{stop: make(chan struct{}), done: make(chan struct{})}
+	q.janitor = j
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				// Failures, such as a locked database, are retried on
+				// the next tick.
+				if q.queries.purgeExpired != "" {
+					_, err := q.PurgeExpired(context.Background())
+					q.backgroundError(err)
+				}
+				if q.opts.Retention.enabled() {
+					_, err := q.Compact(context.Background())
+					q.backgroundError(err)
+				}
+			}
+		}
+	}()
+}
+
+// backgroundError hands an error of the janitor to the queue's
+// OnBackgroundError handler, if it has one.
+func (q *Queue) backgroundError(err error) {
+	if err != nil && q.opts.OnBackgroundError != nil {
+		q.opts.OnBackgroundError(err)
+	}
+}
+
+// close stops the janitor and waits for a running compaction to finish.
+func (j *janitor) close() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	<-j.done
+}
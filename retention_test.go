@@ -0,0 +1,148 @@
+package gopq_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
+)
+
+func dequeueN(t *testing.T, q interface{ TryDequeue() (gopq.Msg, error) }, n int) []gopq.Msg {
+	t.Helper()
+	var msgs []gopq.Msg
+	for i := 0; i < n; i++ {
+		msg, err := q.TryDequeue()
+		require.NoError(t, err)
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestQueue_CompactWithoutPolicy(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Enqueue([]byte(item)))
+	}
+	dequeueN(t, q, 2)
+
+	n, err := q.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assertQueueLen(t, q, 1)
+
+	n, err = q.Purge(ctx, gopq.PurgeAll)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestQueue_CompactMaxProcessed(t *testing.T) {
+	q, err := gopq.NewSimpleQueue("", gopq.WithRetention(gopq.RetentionPolicy{MaxProcessed: 2, Vacuum: true}))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, q.Enqueue([]byte{byte(i)}))
+	}
+	dequeueN(t, q, 5)
+
+	n, err := q.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = q.Purge(ctx, gopq.PurgeAll)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestAckQueue_CompactMaxAge(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		CommonOpts: gopq.CommonOpts{
+			Retention: gopq.RetentionPolicy{MaxAge: time.Hour},
+			Clock:     clock,
+		},
+	})
+	ctx := context.Background()
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Enqueue([]byte(item)))
+	}
+	for _, msg := range dequeueN(t, q, 2) {
+		require.NoError(t, q.Ack(msg.ID))
+	}
+
+	n, err := q.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	clock.Advance(2 * time.Hour)
+	n, err = q.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assertLen(t, q, 1)
+}
+
+func TestQueue_RetentionJanitor(t *testing.T) {
+	path := tempFilePath(t)
+	q, err := gopq.NewSimpleQueue(path, gopq.WithRetention(gopq.RetentionPolicy{
+		MaxProcessed: 1,
+		Interval:     10 * time.Millisecond,
+	}))
+	require.NoError(t, err)
+	defer q.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Enqueue([]byte{byte(i)}))
+	}
+	dequeueN(t, q, 3)
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Eventually(t, func() bool {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM simple_queue").Scan(&count)
+		return err == nil && count == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// New database files use incremental auto vacuum.
+	var autoVacuum int
+	require.NoError(t, db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum))
+	assert.Equal(t, 2, autoVacuum)
+
+	assert.Error(t, gopq.WithRetention(gopq.RetentionPolicy{MaxAge: -time.Hour})(&gopq.Opts{}))
+}
+
+func TestTopic_GroupCompact(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+
+	group, err := topic.Subscribe("group", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	other, err := topic.Subscribe("other", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	require.NoError(t, topic.Publish(ctx, []byte("item")))
+
+	msg, err := group.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, group.Ack(msg.ID))
+
+	n, err := group.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// The other group still receives the item.
+	msg, err = other.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(msg.Item))
+}
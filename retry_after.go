@@ -0,0 +1,79 @@
+package gopq
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrRetryAfter is returned by a Handler to have its message delivered again
+// after Delay instead of after the queue's retry backoff, for example to honor
+// a Retry-After header of a downstream service.
+type ErrRetryAfter struct {
+	Delay time.Duration
+	Err   error
+}
+
+func (e *ErrRetryAfter) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("retry after %v", e.Delay)
+	}
+	return fmt.Sprintf("retry after %v: %v", e.Delay, e.Err)
+}
+
+func (e *ErrRetryAfter) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter wraps err so that a Consumer delivers the message again after delay.
+func RetryAfter(delay time.Duration, err error) error {
+	return &ErrRetryAfter{Delay: delay, Err: err}
+}
+
+// delayedNacker is implemented by queues that support NackWithDelayAndReason.
+type delayedNacker interface {
+	NackWithDelayAndReason(ctx context.Context, id int64, delay time.Duration, err error) error
+}
+
+// TryNackWithDelay indicates that an item processing has failed and should be
+// requeued after delay, instead of after the queue's retry backoff.
+// The retry still counts towards MaxRetries, and a message that has exhausted
+// its retries is handed to the failure callbacks.
+// This is non-blocking, and will return immediately.
+func (q *AcknowledgeableQueue) TryNackWithDelay(ctx context.Context, id int64, delay time.Duration) error {
+	return q.TryNackWithDelayAndReason(ctx, id, delay, nil)
+}
+
+// NackWithDelay indicates that an item processing has failed and should be
+// requeued after delay, instead of after the queue's retry backoff.
+// The retry still counts towards MaxRetries, and a message that has exhausted
+// its retries is handed to the failure callbacks.
+// If the db is locked, this will block until the db is unlocked.
+func (q *AcknowledgeableQueue) NackWithDelay(ctx context.Context, id int64, delay time.Duration) error {
+	return retryWhileLocked(ctx, q.pollInterval, func(ctx context.Context) error {
+		return handleLockedResult(q.TryNackWithDelay(ctx, id, delay))
+	})
+}
+
+// TryNackWithDelayAndReason combines TryNackWithDelay and
+// TryNackWithReason: the item is requeued after delay, and err is added to
+// the failure history of the message.
+// This is non-blocking, and will return immediately.
+func (q *AcknowledgeableQueue) TryNackWithDelayAndReason(ctx context.Context, id int64, delay time.Duration, err error) error {
+	if delay < 0 {
+		return fmt.Errorf("invalid delay %v: must not be negative", delay)
+	}
+	return q.nack(ctx, id, func(int) time.Duration {
+		return delay
+	}, nackReason(err))
+}
+
+// NackWithDelayAndReason combines NackWithDelay and NackWithReason: the item
+// is requeued after delay, and err is added to the failure history of the
+// message.
+// If the db is locked, this will block until the db is unlocked.
+func (q *AcknowledgeableQueue) NackWithDelayAndReason(ctx context.Context, id int64, delay time.Duration, err error) error {
+	return retryWhileLocked(ctx, q.pollInterval, func(ctx context.Context) error {
+		return handleLockedResult(q.TryNackWithDelayAndReason(ctx, id, delay, err))
+	})
+}
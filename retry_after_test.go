@@ -0,0 +1,107 @@
+package gopq_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
+)
+
+func TestAckQueue_NackWithDelay(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, MaxRetries: 3, RetryBackoff: time.Hour, CommonOpts: gopq.CommonOpts{Clock: clock}})
+	ctx := context.Background()
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.NackWithDelay(ctx, msg.ID, 0))
+
+	// The per-call delay replaces the hour-long queue backoff.
+	clock.Advance(time.Millisecond)
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, msg.RetryCount)
+
+	require.NoError(t, q.NackWithDelay(ctx, msg.ID, time.Hour))
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+
+	assert.Error(t, q.TryNackWithDelay(ctx, msg.ID, -time.Second))
+}
+
+func TestAckQueue_NackWithDelayRespectsMaxRetries(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, MaxRetries: 0})
+	dlq := setupTestQueue(t)
+	q.RegisterDeadLetterQueue(dlq)
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.NackWithDelay(context.Background(), msg.ID, time.Second))
+
+	dead, err := dlq.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(dead.Item))
+
+	var notFound *gopq.ErrMessageNotFound
+	err = q.NackWithDelay(context.Background(), msg.ID, time.Second)
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestConsumer_RetryAfter(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, MaxRetries: 3, RetryBackoff: time.Hour})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	rateLimited := errors.New("429 too many requests")
+	attempts := make(chan int, 2)
+	stop := runConsumer(t, gopq.NewConsumer(q, func(ctx context.Context, msg gopq.Msg) error {
+		attempts <- msg.RetryCount
+		if msg.RetryCount == 0 {
+			return gopq.RetryAfter(0, rateLimited)
+		}
+		return nil
+	}, gopq.ConsumerOpts{}))
+	defer stop()
+
+	for want := 0; want < 2; want++ {
+		select {
+		case got := <-attempts:
+			assert.Equal(t, want, got)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message was not redelivered after its retry delay")
+		}
+	}
+
+	err := gopq.RetryAfter(time.Second, rateLimited)
+	assert.ErrorIs(t, err, rateLimited)
+}
+
+func TestConsumer_RetryAfterRecordsReason(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, MaxRetries: 0})
+	dead := make(chan gopq.DeadLetter, 1)
+	q.RegisterOnDeadLetterCallback(func(dl gopq.DeadLetter) error {
+		dead <- dl
+		return nil
+	})
+	require.NoError(t, q.Enqueue([]byte("item")))
+
+	stop := runConsumer(t, gopq.NewConsumer(q, func(ctx context.Context, msg gopq.Msg) error {
+		return gopq.RetryAfter(time.Second, errors.New("429 too many requests"))
+	}, gopq.ConsumerOpts{}))
+	defer stop()
+
+	select {
+	case dl := <-dead:
+		assert.Contains(t, dl.LastError, "429 too many requests")
+		require.Len(t, dl.Failures, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not dead lettered")
+	}
+}
@@ -6,29 +6,32 @@
 create table gopq_ackqueue (
     id integer not null auto_increment primary key,
     item blob(1024) not null,
-    enqueued_at timestamp default current_timestamp,
+    attributes text,
+    expires_at bigint,
+    enqueued_at timestamp(3) default current_timestamp(3),
     processed_at timestamp,
-    ack_deadline int,
+    ack_deadline bigint,
     retry_count int default 0
 );
 
 -- Inserts the item into the table.
-create procedure gopq_push_ack(it blob(1024))
+create procedure gopq_push_ack(it blob(1024), attrs text, expires bigint)
 begin
-    insert into gopq_ackqueue (item) value (it) on duplicate key update item = it;
+    insert into gopq_ackqueue (item, attributes, expires_at) value (it, attrs, expires) on duplicate key update item = it;
 end;
 
 -- Dequeue element from the queue. Until `deadline˙ passes this element will not
 -- be considered for dequeueing.
-create procedure gopq_pop_ack(now int, deadline int)
+create procedure gopq_pop_ack(now bigint, deadline bigint)
 begin
-    select id, item
-    into @id, @item
+    select id, item, attributes, floor(unix_timestamp(enqueued_at) * 1000), retry_count
+    into @id, @item, @attributes, @enqueued_at, @retry_count
     from gopq_ackqueue
     where 
             (coalesce(ack_deadline, 0) < now)
         and processed_at is null
-    order by enqueued_at asc
+        and (expires_at is null or expires_at > now)
+    order by enqueued_at asc, id asc
     limit 1;
 
     if found_rows() = 1 then
@@ -36,13 +39,16 @@ begin
         set ack_deadline = deadline 
         where id = @id;
 
-        select @id as id, @item as item
+        select
+            @id as id, @item as item, @attributes as attributes,
+            @enqueued_at as enqueued_at, @retry_count as retry_count,
+            deadline as ack_deadline
         where @id is not null;
     end if;
 end;
 
 -- Ack processing of the element. Record is removed from the table.
-create procedure gopq_ack_delete(id int, now int)
+create procedure gopq_ack_delete(id int, now bigint)
 begin
     delete from gopq_ackqueue
     where
@@ -51,7 +57,7 @@ begin
 end;
 
 -- Ack processing of the element. Record is marked as processed.
-create procedure gopq_ack_store(id int, now int)
+create procedure gopq_ack_store(id int, now bigint)
 begin
     update gopq_ackqueue
     set processed_at = current_timestamp
@@ -62,12 +68,13 @@ end;
 
 -- Return the number of elements in the queue. If the deadline is in the future
 -- then the record doesn't count.
-create procedure gopq_len_ack(now int)
+create procedure gopq_len_ack(now bigint)
 begin
     select count(1) from gopq_ackqueue
     where 
             (coalesce(ack_deadline, 0) < now)
-        and processed_at is null;
+        and processed_at is null
+        and (expires_at is null or expires_at > now);
 end;
 
 -- Return the internal processing details of the record.
@@ -86,8 +93,8 @@ end
 -- than allowed number of times.
 create procedure gopq_deleteItem(id int)
 begin
-  select item
-    into @item
+  select item, attributes
+    into @item, @attributes
     from gopq_ackqueue
     where 
         gopq_ackqueue.id = id;
@@ -95,12 +102,12 @@ begin
     delete from gopq_ackqueue
     where gopq_ackqueue.id = @id;
 
-    select @item as item;
+    select @item as item, @attributes as attributes;
 end
 
 -- Moves the record's deadline (into the future, deadline > now), thus putting
 -- it back to the queue.
-create procedure gopq_updateForRetry(deadline int, id int)
+create procedure gopq_updateForRetry(deadline bigint, id int)
 begin
     update gopq_ackqueue
     set 
@@ -112,7 +119,7 @@ end
 
 -- Moves the record's deadline (into the future, deadline > now) but keeps the
 -- retry counter.
-create procedure gopq_expireAckDeadline(deadline int, id int)
+create procedure gopq_expireAckDeadline(deadline bigint, id int)
 begin
     update gopq_ackqueue
     set 
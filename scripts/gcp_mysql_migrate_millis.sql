@@ -0,0 +1,28 @@
+-- Migration of Google Cloud MySql queues created by gopq 0.2 to the current
+-- schema, which stores times as Unix milliseconds.
+--
+-- Stop all producers and consumers, run the section matching the queue, then
+-- drop the stored procedures and create them again from the matching
+-- gcp_mysql_*.sql script. Ack deadlines that are already in milliseconds are
+-- left alone, so running the update twice does no harm.
+--
+-- 2026-10-18
+
+-- Simple and unique queues (gcp_mysql_simple_queue.sql,
+-- gcp_mysql_unique_queue.sql).
+alter table gopq_queue
+    add column attributes text after item,
+    add column expires_at bigint after attributes,
+    modify enqueued_at timestamp(3) default current_timestamp(3);
+
+-- Ack and unique ack queues (gcp_mysql_ackqueue.sql,
+-- gcp_mysql_unique_ackqueue.sql). Ack deadlines were stored in Unix seconds.
+alter table gopq_ackqueue
+    add column attributes text after item,
+    add column expires_at bigint after attributes,
+    modify enqueued_at timestamp(3) default current_timestamp(3),
+    modify ack_deadline bigint;
+
+update gopq_ackqueue
+set ack_deadline = ack_deadline * 1000
+where ack_deadline < 100000000000;
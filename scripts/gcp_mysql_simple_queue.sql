@@ -6,26 +6,29 @@
 create table gopq_queue (
     id integer not null auto_increment primary key,
     item blob(1024) not null,
-    enqueued_at timestamp default current_timestamp,
+    attributes text,
+    expires_at bigint,
+    enqueued_at timestamp(3) default current_timestamp(3),
     processed_at timestamp
 );
 
 -- Inserts the item into the table.
-create procedure gopq_push(it blob(1024))
+create procedure gopq_push(it blob(1024), attrs text, expires bigint)
 begin
-    insert into gopq_queue (item) value (it);
+    insert into gopq_queue (item, attributes, expires_at) value (it, attrs, expires);
 end;
 
 -- Dequeue element from the queue. Element is left in the table but no longer
 -- considered for any queue operation.
 create procedure gopq_pop_store()
 begin
-    select id, item
-    into @id, @item
+    select id, item, attributes
+    into @id, @item, @attributes
     from gopq_queue
     where 
         processed_at is null
-    order by enqueued_at asc
+        and (expires_at is null or expires_at > unix_timestamp(now(3)) * 1000)
+    order by enqueued_at asc, id asc
     limit 1;
 
     if found_rows() = 1 then
@@ -33,26 +36,27 @@ begin
         set processed_at = current_timestamp
         where id = @id;
 
-        select @id as id, @item as item;
+        select @id as id, @item as item, @attributes as attributes;
     end if;
 end;
 
 -- Dequeue element from the queue and deletes the record from the table. 
 create procedure gopq_pop_delete()
 begin
-    select id, item
-    into @id, @item
+    select id, item, attributes
+    into @id, @item, @attributes
     from gopq_queue
     where 
         processed_at is null
-    order by enqueued_at asc
+        and (expires_at is null or expires_at > unix_timestamp(now(3)) * 1000)
+    order by enqueued_at asc, id asc
     limit 1;
 
     if found_rows() = 1 then
         delete from gopq_queue
         where id = @id;
 
-        select @id as id, @item as item;
+        select @id as id, @item as item, @attributes as attributes;
     end if;
 end;
 
@@ -61,5 +65,6 @@ create procedure gopq_len()
 begin
     select count(1) 
     from gopq_queue
-    where processed_at is null;
+    where processed_at is null
+        and (expires_at is null or expires_at > unix_timestamp(now(3)) * 1000);
 end;
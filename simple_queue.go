@@ -1,6 +1,7 @@
 package gopq
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/mattdeak/gopq/internal"
@@ -11,60 +12,139 @@ const (
         CREATE TABLE IF NOT EXISTS %[1]s (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             item BLOB NOT NULL,
-            enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            processed_at TIMESTAMP
+            enqueued_at INTEGER,
+            processed_at TIMESTAMP,
+            visible_at INTEGER,
+            attributes TEXT,
+            expires_at INTEGER,
+            codec TEXT
         );
-        CREATE INDEX IF NOT EXISTS idx_processed ON %[1]s(processed_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_processed ON %[1]s(processed_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_visible_at ON %[1]s(visible_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s(expires_at);
     `
 	simpleEnqueueQuery = `
-        INSERT INTO %s (item) VALUES (?)
+        INSERT INTO %s (item, expires_at, codec, enqueued_at) VALUES (?, ?, ?, ?)
     `
 	simpleTryDequeueQuery = `
 		WITH oldest AS (
 			SELECT id, item
 			FROM %[1]s
-			WHERE processed_at IS NULL
-			ORDER BY enqueued_at ASC
+			WHERE processed_at IS NULL AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
 			LIMIT 1
 		)
 		UPDATE %[1]s
-		SET processed_at = CURRENT_TIMESTAMP
+		SET processed_at = datetime(?1 / 1000.0, 'unixepoch')
 		WHERE id = (SELECT id FROM oldest)
-		RETURNING id, item
+		RETURNING id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
+    `
+	simpleTryDequeueBatchQuery = `
+		WITH batch AS MATERIALIZED (
+			SELECT id, row_number() OVER (ORDER BY enqueued_at ASC, id ASC) AS position
+			FROM %[1]s
+			WHERE processed_at IS NULL AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
+			LIMIT ?2
+		)
+		UPDATE %[1]s
+		SET processed_at = datetime(?1 / 1000.0, 'unixepoch')
+		WHERE id IN (SELECT id FROM batch)
+		RETURNING (SELECT position FROM batch WHERE batch.id = %[1]s.id), id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
     `
 	simpleLenQuery = `
-        SELECT COUNT(*) FROM %s WHERE processed_at IS NULL
+        SELECT COUNT(*) FROM %s WHERE processed_at IS NULL AND (visible_at IS NULL OR visible_at <= ?1)
+            AND (expires_at IS NULL OR expires_at > ?1)
     `
 )
 
 // NewSimpleQueue creates a new simple queue.
 // If filePath is empty, the queue will be created in memory.
-func NewSimpleQueue(filePath string) (*Queue, error) {
+func NewSimpleQueue(filePath string, opts ...QueueOptions) (*Queue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create simple queue: %w", err)
+	}
+
 	db, err := internal.InitializeDB(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	tableName := internal.DetermineTableName("simple_queue", filePath)
+	return newSimpleQueue(db, tableName, internal.MakeNotifyChan(), qo)
+}
 
+// newSimpleQueue creates a simple queue in the given table of db.
+func newSimpleQueue(db *sql.DB, tableName string, notifyChan chan struct{}, qo Opts) (*Queue, error) {
 	formattedCreateTableQuery := fmt.Sprintf(simpleCreateTableQuery, tableName)
 	formattedEnqueueQuery := fmt.Sprintf(simpleEnqueueQuery, tableName)
 	formattedTryDequeueQuery := fmt.Sprintf(simpleTryDequeueQuery, tableName)
+	formattedTryDequeueBatchQuery := fmt.Sprintf(simpleTryDequeueBatchQuery, tableName)
 	formattedLenQuery := fmt.Sprintf(simpleLenQuery, tableName)
+	formattedEnqueueAtQuery := fmt.Sprintf(delayedEnqueueQuery, tableName)
+	formattedEnqueueAttributesQuery := fmt.Sprintf(attributesEnqueueQuery, tableName)
+	formattedNextVisibleQuery := fmt.Sprintf(delayedNextVisibleQuery, tableName)
+	formattedLenExpiredQuery := fmt.Sprintf(ttlLenExpiredQuery, tableName, expiredCondition)
+	formattedPurgeExpiredQuery := fmt.Sprintf(ttlPurgeExpiredQuery, tableName, expiredCondition)
+	formattedPeekQuery := fmt.Sprintf(browseQuery, tableName, readyCondition, fifoOrder)
+	formattedBrowseQuery := fmt.Sprintf(browseQuery, tableName, pendingCondition, fifoOrder)
+	formattedDeleteByIDQuery := fmt.Sprintf(adminDeleteQuery, tableName)
+	formattedPurgePendingQuery := fmt.Sprintf(adminPurgeQuery, tableName, unprocessedFilter)
+	formattedPurgeAllQuery := fmt.Sprintf(adminPurgeQuery, tableName, "")
+	formattedRequeueQuery := fmt.Sprintf(adminRequeueQuery, tableName, requeueSet)
+	formattedCompactAgeQuery := fmt.Sprintf(compactAgeQuery, tableName)
+	formattedCompactCountQuery := fmt.Sprintf(compactCountQuery, tableName)
+
+	common, err := qo.CommonOpts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	err = internal.MigrateTable(db, tableName, addedColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	err = internal.MigrateMillis(db, tableName, millisColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
 
-	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedLenQuery)
+	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedTryDequeueBatchQuery, formattedLenQuery, formattedEnqueueAtQuery, formattedEnqueueAttributesQuery, formattedNextVisibleQuery, formattedLenExpiredQuery, formattedPurgeExpiredQuery, formattedPeekQuery, formattedBrowseQuery, formattedDeleteByIDQuery, formattedPurgePendingQuery, formattedPurgeAllQuery, formattedRequeueQuery, formattedCompactAgeQuery, formattedCompactCountQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare database: %w", err)
 	}
 
-	return &Queue{
+	q := &Queue{
 		db:           db,
+		name:         tableName,
 		pollInterval: defaultPollInterval,
-		notifyChan:   internal.MakeNotifyChan(),
+		notifyChan:   notifyChan,
 		queries: baseQueries{
-			enqueue:     formattedEnqueueQuery,
-			tryDequeue:  formattedTryDequeueQuery,
-			len:         formattedLenQuery,
+			enqueue:           formattedEnqueueQuery,
+			enqueueAt:         formattedEnqueueAtQuery,
+			enqueueAttributes: formattedEnqueueAttributesQuery,
+			tryDequeue:        formattedTryDequeueQuery,
+			tryDequeueBatch:   formattedTryDequeueBatchQuery,
+			len:               formattedLenQuery,
+			nextVisible:       formattedNextVisibleQuery,
+			lenExpired:        formattedLenExpiredQuery,
+			purgeExpired:      formattedPurgeExpiredQuery,
+			peek:              formattedPeekQuery,
+			browse:            formattedBrowseQuery,
+			deleteByID:        formattedDeleteByIDQuery,
+			purgePending:      formattedPurgePendingQuery,
+			purgeAll:          formattedPurgeAllQuery,
+			requeue:           formattedRequeueQuery,
+			compactAge:        formattedCompactAgeQuery,
+			compactCount:      formattedCompactCountQuery,
+			vacuum:            compactVacuumQuery,
 		},
-	}, nil
+		opts: common,
+		mode: modeCodec,
+	}
+	q.startJanitor()
+	return q, nil
 }
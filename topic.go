@@ -0,0 +1,503 @@
+package gopq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mattdeak/gopq/internal"
+)
+
+const (
+	topicCreateTableQuery = `
+        CREATE TABLE IF NOT EXISTS %[1]s_messages (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            item BLOB NOT NULL,
+            attributes TEXT,
+            enqueued_at INTEGER
+        );
+        CREATE TABLE IF NOT EXISTS %[1]s_groups (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL UNIQUE
+        );
+        CREATE TABLE IF NOT EXISTS %[1]s_deliveries (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            message_id INTEGER NOT NULL,
+            group_id INTEGER NOT NULL,
+            enqueued_at INTEGER,
+            processed_at TIMESTAMP,
+            ack_deadline INTEGER,
+            retry_count INTEGER DEFAULT 0,
+            first_attempt_at INTEGER,
+            last_attempt_at INTEGER,
+            failures TEXT
+        );
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_deliveries_group ON %[1]s_deliveries(group_id, processed_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_deliveries_message ON %[1]s_deliveries(message_id);
+
+        -- The payload of a message is deleted together with the last
+        -- delivery that still has to be processed.
+        CREATE TRIGGER IF NOT EXISTS trg_%[1]s_deliveries_processed
+        AFTER UPDATE OF processed_at ON %[1]s_deliveries
+        WHEN NEW.processed_at IS NOT NULL
+        BEGIN
+            DELETE FROM %[1]s_messages WHERE id = NEW.message_id AND NOT EXISTS (
+                SELECT 1 FROM %[1]s_deliveries WHERE message_id = NEW.message_id AND processed_at IS NULL
+            );
+        END;
+        CREATE TRIGGER IF NOT EXISTS trg_%[1]s_deliveries_deleted
+        AFTER DELETE ON %[1]s_deliveries
+        WHEN OLD.processed_at IS NULL
+        BEGIN
+            DELETE FROM %[1]s_messages WHERE id = OLD.message_id AND NOT EXISTS (
+                SELECT 1 FROM %[1]s_deliveries WHERE message_id = OLD.message_id AND processed_at IS NULL
+            );
+        END;
+    `
+	topicPublishQuery = `
+        INSERT INTO %s_messages (item, attributes, enqueued_at) VALUES (?, ?, ?)
+    `
+	topicDeliverQuery = `
+        INSERT INTO %[1]s_deliveries (message_id, group_id, enqueued_at)
+        SELECT ?, id, ? FROM %[1]s_groups
+    `
+	topicSubscribeQuery = `
+        INSERT INTO %[1]s_groups (name) VALUES (?1)
+        ON CONFLICT (name) DO UPDATE SET name = ?1
+        RETURNING id
+    `
+	topicUnsubscribeQuery = `
+        DELETE FROM %[1]s_groups WHERE name = ? RETURNING id
+    `
+	topicDeleteDeliveriesQuery = `
+        DELETE FROM %[1]s_deliveries WHERE group_id = ?
+    `
+	topicDeleteUndeliveredQuery = `
+        DELETE FROM %[1]s_messages
+        WHERE NOT EXISTS (SELECT 1 FROM %[1]s_deliveries WHERE message_id = %[1]s_messages.id)
+    `
+
+	// The queries of a consumer group work on its rows of the deliveries
+	// table and read the payload from the messages table.
+	topicColumns = `id,
+            (SELECT item FROM %[1]s_messages WHERE id = message_id),
+            (SELECT attributes FROM %[1]s_messages WHERE id = message_id),
+            CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, NULL
+    `
+	topicReturning = `
+        RETURNING ` + topicColumns
+	topicTryDequeueQuery = `
+		WITH oldest AS (
+			SELECT id
+			FROM %[1]s_deliveries
+			WHERE group_id = %[2]d AND processed_at IS NULL
+				AND (ack_deadline < ?1 OR ack_deadline IS NULL)
+			ORDER BY id ASC
+			LIMIT 1
+		)
+		UPDATE %[1]s_deliveries
+		SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1
+		WHERE id = (SELECT id FROM oldest)
+    ` + topicReturning
+	topicTryDequeueBatchQuery = `
+		WITH batch AS MATERIALIZED (
+			SELECT id, row_number() OVER (ORDER BY id ASC) AS position
+			FROM %[1]s_deliveries
+			WHERE group_id = %[2]d AND processed_at IS NULL
+				AND (ack_deadline < ?1 OR ack_deadline IS NULL)
+			ORDER BY id ASC
+			LIMIT ?3
+		)
+		UPDATE %[1]s_deliveries
+		SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1
+		WHERE id IN (SELECT id FROM batch)
+        RETURNING (SELECT position FROM batch WHERE batch.id = %[1]s_deliveries.id), ` + topicColumns
+	topicLenQuery = `
+        SELECT COUNT(*) FROM %[1]s_deliveries
+        WHERE group_id = %[2]d AND processed_at IS NULL
+            AND (ack_deadline IS NULL OR ack_deadline < ?1)
+    `
+	topicBrowseQuery = `
+        SELECT id,
+            (SELECT item FROM %[1]s_messages WHERE id = message_id),
+            (SELECT attributes FROM %[1]s_messages WHERE id = message_id),
+            CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, NULL
+        FROM %[1]s_deliveries
+        WHERE group_id = %[2]d AND processed_at IS NULL%[3]s
+        ORDER BY id ASC
+        LIMIT ?2 OFFSET ?3
+    `
+	topicReadyCondition = `
+            AND (ack_deadline < ?1 OR ack_deadline IS NULL)`
+	topicDeleteByIDQuery = `
+        DELETE FROM %[1]s_deliveries WHERE id = ? AND group_id = %[2]d
+    `
+	topicPurgeQuery = `
+        DELETE FROM %[1]s_deliveries WHERE group_id = %[2]d%[3]s
+    `
+	// Processed deliveries can only be requeued while another group still
+	// holds on to their payload.
+	topicRequeueQuery = `
+        UPDATE %[1]s_deliveries
+        SET processed_at = NULL, ack_deadline = NULL, retry_count = 0
+        WHERE id = ? AND group_id = %[2]d
+            AND message_id IN (SELECT id FROM %[1]s_messages)
+    `
+	topicCompactAgeQuery = `
+        DELETE FROM %[1]s_deliveries
+        WHERE group_id = %[2]d AND processed_at < datetime(?1 / 1000.0, 'unixepoch')
+    `
+	topicCompactCountQuery = `
+        DELETE FROM %[1]s_deliveries
+        WHERE group_id = %[2]d AND processed_at IS NOT NULL AND id NOT IN (
+            SELECT id FROM %[1]s_deliveries WHERE group_id = %[2]d AND processed_at IS NOT NULL
+            ORDER BY processed_at DESC, id DESC
+            LIMIT ?1
+        )
+    `
+	topicDeleteFailedQuery = `
+        DELETE FROM %[1]s_deliveries WHERE id = ?
+        RETURNING
+            (SELECT item FROM %[1]s_messages WHERE id = message_id),
+            (SELECT attributes FROM %[1]s_messages WHERE id = message_id),
+            CAST(enqueued_at AS INTEGER), retry_count,
+            first_attempt_at, last_attempt_at, failures, NULL
+    `
+)
+
+// Topic is a publish/subscribe channel. Every published message is delivered
+// once to every subscribed consumer group. Each group consumes the topic
+// through its own AcknowledgeableQueue with independent ack, nack and retry
+// state, while the payload is stored only once. The payload is deleted as
+// soon as every group has acknowledged, dead lettered or removed the message.
+type Topic struct {
+	db        *sql.DB
+	tableName string
+	shared    bool
+
+	// clock is the source of the publish time of items.
+	clock Clock
+
+	queries  topicQueries
+	notifier *topicNotifier
+}
+
+// topicNotifier holds the notification channels of the consumer groups of a
+// topic, so that all handles of the topic wake up the same consumers.
+type topicNotifier struct {
+	mu          sync.Mutex
+	notifyChans map[int64]chan struct{}
+}
+
+func newTopicNotifier() *topicNotifier {
+	return &topicNotifier{notifyChans: map[int64]chan struct{}{}}
+}
+
+type topicQueries struct {
+	publish           string
+	deliver           string
+	subscribe         string
+	unsubscribe       string
+	deleteDeliveries  string
+	deleteUndelivered string
+}
+
+// NewTopic creates a new topic.
+// If filePath is empty, the topic will be created in memory.
+// Of the options, only WithClock applies to topics. Its clock is also used
+// by consumer groups that do not set one in their AckOpts.
+func NewTopic(filePath string, opts ...QueueOptions) (*Topic, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create topic: %w", err)
+	}
+
+	db, err := internal.InitializeDB(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topic: %w", err)
+	}
+
+	tableName := internal.DetermineTableName("topic", filePath)
+	return newTopic(db, tableName, newTopicNotifier(), qo)
+}
+
+// newTopic creates a topic in the given tables of db.
+func newTopic(db *sql.DB, tableName string, notifier *topicNotifier, opts Opts) (*Topic, error) {
+	formattedCreateTableQuery := fmt.Sprintf(topicCreateTableQuery, tableName)
+	formattedPublishQuery := fmt.Sprintf(topicPublishQuery, tableName)
+	formattedDeliverQuery := fmt.Sprintf(topicDeliverQuery, tableName)
+	formattedSubscribeQuery := fmt.Sprintf(topicSubscribeQuery, tableName)
+	formattedUnsubscribeQuery := fmt.Sprintf(topicUnsubscribeQuery, tableName)
+	formattedDeleteDeliveriesQuery := fmt.Sprintf(topicDeleteDeliveriesQuery, tableName)
+	formattedDeleteUndeliveredQuery := fmt.Sprintf(topicDeleteUndeliveredQuery, tableName)
+
+	err := internal.MigrateTable(db, tableName+"_deliveries", deadLetterColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topic: %w", err)
+	}
+
+	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedPublishQuery, formattedDeliverQuery, formattedSubscribeQuery, formattedUnsubscribeQuery, formattedDeleteDeliveriesQuery, formattedDeleteUndeliveredQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topic: %w", err)
+	}
+
+	return &Topic{
+		db:        db,
+		tableName: tableName,
+		queries: topicQueries{
+			publish:           formattedPublishQuery,
+			deliver:           formattedDeliverQuery,
+			subscribe:         formattedSubscribeQuery,
+			unsubscribe:       formattedUnsubscribeQuery,
+			deleteDeliveries:  formattedDeleteDeliveriesQuery,
+			deleteUndelivered: formattedDeleteUndeliveredQuery,
+		},
+		clock:    queueClock(opts.Clock),
+		notifier: notifier,
+	}, nil
+}
+
+// Close closes the database connection associated with the topic.
+// Topics handed out by a Broker share its connection, which stays open until
+// the Broker is closed.
+func (t *Topic) Close() error {
+	if t.shared {
+		return nil
+	}
+	return t.db.Close()
+}
+
+// Publish delivers an item to every consumer group subscribed to the topic.
+// Items published while no group is subscribed are dropped.
+// It returns an error if the operation fails or the context is cancelled.
+func (t *Topic) Publish(ctx context.Context, item []byte) error {
+	return t.PublishWithAttributes(ctx, item, nil)
+}
+
+// TryPublish attempts to deliver an item to every subscribed consumer group.
+// This is non-blocking, and will return immediately.
+func (t *Topic) TryPublish(ctx context.Context, item []byte) error {
+	return t.TryPublishWithAttributes(ctx, item, nil)
+}
+
+// PublishWithAttributes delivers an item together with attributes to every
+// consumer group subscribed to the topic.
+// It returns an error if the operation fails or the context is cancelled.
+func (t *Topic) PublishWithAttributes(ctx context.Context, item []byte, attributes map[string]string) error {
+	return retryWhileLocked(ctx, defaultPollInterval, func(ctx context.Context) error {
+		return t.TryPublishWithAttributes(ctx, item, attributes)
+	})
+}
+
+// TryPublishWithAttributes attempts to deliver an item together with
+// attributes to every subscribed consumer group.
+// This is non-blocking, and will return immediately.
+func (t *Topic) TryPublishWithAttributes(ctx context.Context, item []byte, attributes map[string]string) error {
+	encoded, err := encodeAttributes(attributes)
+	if err != nil {
+		return err
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return handleLockedResult(err)
+	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
+
+	now := t.clock.Now().UnixMilli()
+	res, err := tx.ExecContext(ctx, t.queries.publish, item, encoded, now)
+	if err != nil {
+		return handleLockedResult(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read message id: %w", err)
+	}
+
+	res, err = tx.ExecContext(ctx, t.queries.deliver, id, now)
+	if err != nil {
+		return handleLockedResult(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		// Nobody is subscribed, there is nothing to keep.
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return handleLockedResult(err)
+	}
+
+	t.notifier.notifyAll()
+	return nil
+}
+
+// Subscribe returns the queue of the consumer group with the given name,
+// creating the group if it does not exist yet. A new group receives the
+// items published from then on. Groups are durable: they keep receiving
+// items until they are removed with Unsubscribe.
+// All consumers of a group share its queue state, so every item is
+// delivered to one consumer of each group. Items cannot be enqueued to the
+// returned queue directly; use Publish.
+// Group names may contain letters, digits and underscores. Groups do not
+// store items themselves, so opts must not set TTL, Compression, KeyFunc,
+// Uniqueness or DedupeWindow.
+func (t *Topic) Subscribe(group string, opts AckOpts) (*AcknowledgeableQueue, error) {
+	if !queueNamePattern.MatchString(group) {
+		return nil, fmt.Errorf("invalid group name %q: only letters, digits and underscores are allowed", group)
+	}
+	if err := checkGroupOpts(opts.CommonOpts); err != nil {
+		return nil, err
+	}
+
+	var groupID int64
+	err := t.db.QueryRow(t.queries.subscribe, group).Scan(&groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	deliveries := t.tableName + "_deliveries"
+	formattedTryDequeueQuery := fmt.Sprintf(topicTryDequeueQuery, t.tableName, groupID)
+	formattedTryDequeueBatchQuery := fmt.Sprintf(topicTryDequeueBatchQuery, t.tableName, groupID)
+	formattedLenQuery := fmt.Sprintf(topicLenQuery, t.tableName, groupID)
+	formattedAckQuery := fmt.Sprintf(ackAckActs[opts.AckAction], deliveries)
+	formattedDeleteFailedQuery := fmt.Sprintf(topicDeleteFailedQuery, t.tableName)
+	formattedPeekQuery := fmt.Sprintf(topicBrowseQuery, t.tableName, groupID, topicReadyCondition)
+	formattedBrowseQuery := fmt.Sprintf(topicBrowseQuery, t.tableName, groupID, "")
+	formattedDeleteByIDQuery := fmt.Sprintf(topicDeleteByIDQuery, t.tableName, groupID)
+	formattedPurgePendingQuery := fmt.Sprintf(topicPurgeQuery, t.tableName, groupID, " AND processed_at IS NULL")
+	formattedPurgeAllQuery := fmt.Sprintf(topicPurgeQuery, t.tableName, groupID, "")
+	formattedRequeueQuery := fmt.Sprintf(topicRequeueQuery, t.tableName, groupID)
+	formattedCompactAgeQuery := fmt.Sprintf(topicCompactAgeQuery, t.tableName, groupID)
+	formattedCompactCountQuery := fmt.Sprintf(topicCompactCountQuery, t.tableName, groupID)
+
+	err = internal.PrepareDB(t.db, "", formattedTryDequeueQuery, formattedTryDequeueBatchQuery, formattedLenQuery, formattedAckQuery, formattedDeleteFailedQuery, formattedPeekQuery, formattedBrowseQuery, formattedDeleteByIDQuery, formattedPurgePendingQuery, formattedPurgeAllQuery, formattedRequeueQuery, formattedCompactAgeQuery, formattedCompactCountQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	q := &AcknowledgeableQueue{
+		Queue: Queue{
+			db:           t.db,
+			name:         t.tableName + "." + group,
+			pollInterval: defaultPollInterval,
+			notifyChan:   t.notifier.notifyChan(groupID),
+			queries: baseQueries{
+				tryDequeue:      formattedTryDequeueQuery,
+				tryDequeueBatch: formattedTryDequeueBatchQuery,
+				len:             formattedLenQuery,
+				peek:            formattedPeekQuery,
+				browse:          formattedBrowseQuery,
+				deleteByID:      formattedDeleteByIDQuery,
+				purgePending:    formattedPurgePendingQuery,
+				purgeAll:        formattedPurgeAllQuery,
+				requeue:         formattedRequeueQuery,
+				compactAge:      formattedCompactAgeQuery,
+				compactCount:    formattedCompactCountQuery,
+				compactOrphans:  t.queries.deleteUndelivered,
+				vacuum:          compactVacuumQuery,
+			},
+			opts: CommonOpts{Clock: opts.Clock, Retention: opts.Retention, OnBackgroundError: opts.OnBackgroundError}.or(CommonOpts{Clock: t.clock}),
+			mode: modeShared,
+		},
+		AckOpts: opts,
+		ackQueries: ackQueries{
+			ack: formattedAckQuery,
+			ackUtilsQueries: ackUtilsQueries{
+				details:       fmt.Sprintf(sqlite.details, deliveries),
+				delete:        formattedDeleteFailedQuery,
+				forRetry:      fmt.Sprintf(sqlite.forRetry, deliveries),
+				expire:        fmt.Sprintf(sqlite.expire, deliveries),
+				extend:        fmt.Sprintf(sqlite.extend, deliveries),
+				recordFailure: fmt.Sprintf(sqlite.recordFailure, deliveries),
+			},
+		},
+	}
+	q.startJanitor()
+	return q, nil
+}
+
+// Unsubscribe removes a consumer group together with the items it has not
+// consumed yet. Removing a group that does not exist is not an error.
+func (t *Topic) Unsubscribe(ctx context.Context, group string) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback() // will fail if committed, but that's fine
+	}()
+
+	var groupID int64
+	err = tx.QueryRowContext(ctx, t.queries.unsubscribe, group).Scan(&groupID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, t.queries.deleteDeliveries, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, t.queries.deleteUndelivered)
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// notifyChan returns the notification channel shared by all consumers of a group.
+func (n *topicNotifier) notifyChan(groupID int64) chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	notifyChan, ok := n.notifyChans[groupID]
+	if !ok {
+		notifyChan = internal.MakeNotifyChan()
+		n.notifyChans[groupID] = notifyChan
+	}
+	return notifyChan
+}
+
+// notifyAll wakes up a waiting consumer of every group.
+func (n *topicNotifier) notifyAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, notifyChan := range n.notifyChans {
+		select {
+		case notifyChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// checkGroupOpts rejects the settings that only apply to queues storing
+// their own items, which consumer groups would otherwise silently ignore.
+func checkGroupOpts(opts CommonOpts) error {
+	var unsupported []string
+	if opts.TTL != 0 {
+		unsupported = append(unsupported, "TTL")
+	}
+	if opts.Compression != nil {
+		unsupported = append(unsupported, "Compression")
+	}
+	if opts.KeyFunc != nil {
+		unsupported = append(unsupported, "KeyFunc")
+	}
+	if opts.Uniqueness != 0 {
+		unsupported = append(unsupported, "Uniqueness")
+	}
+	if opts.DedupeWindow != 0 {
+		unsupported = append(unsupported, "DedupeWindow")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("consumer groups do not support %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
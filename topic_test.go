@@ -0,0 +1,290 @@
+package gopq_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+func setupTestTopic(t *testing.T) *gopq.Topic {
+	tempFile := tempFilePath(t)
+	t.Cleanup(func() { os.Remove(tempFile) })
+
+	topic, err := gopq.NewTopic(tempFile)
+	require.NoError(t, err)
+	t.Cleanup(func() { topic.Close() })
+	return topic
+}
+
+func TestTopic_EveryGroupReceivesEveryMessage(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+	opts := gopq.AckOpts{AckTimeout: time.Minute}
+
+	audit, err := topic.Subscribe("audit", opts)
+	require.NoError(t, err)
+	indexing, err := topic.Subscribe("indexing", opts)
+	require.NoError(t, err)
+
+	require.NoError(t, topic.Publish(ctx, []byte("first")))
+	require.NoError(t, topic.PublishWithAttributes(ctx, []byte("second"), map[string]string{"tenant": "a"}))
+
+	for _, group := range []*gopq.AcknowledgeableQueue{audit, indexing} {
+		assertLen(t, group, 2)
+
+		msg, err := group.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, "first", string(msg.Item))
+		assert.False(t, msg.EnqueuedAt.IsZero())
+		require.NoError(t, group.Ack(msg.ID))
+
+		msg, err = group.TryDequeue()
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(msg.Item))
+		assert.Equal(t, "a", msg.Attributes["tenant"])
+		require.NoError(t, group.Ack(msg.ID))
+
+		assertLen(t, group, 0)
+	}
+}
+
+func TestTopic_GroupsRetryIndependently(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+
+	audit, err := topic.Subscribe("audit", gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	require.NoError(t, err)
+	indexing, err := topic.Subscribe("indexing", gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 3})
+	require.NoError(t, err)
+
+	dlq := setupTestQueue(t)
+	audit.RegisterDeadLetterQueue(dlq)
+
+	require.NoError(t, topic.Publish(ctx, []byte("event")))
+
+	msg, err := audit.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, audit.Nack(msg.ID))
+	assertLen(t, audit, 0)
+
+	dead, err := dlq.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "event", string(dead.Item))
+
+	msg, err = indexing.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, indexing.Nack(msg.ID))
+	require.NoError(t, indexing.ExpireAck(msg.ID))
+
+	msg, err = indexing.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "event", string(msg.Item))
+	assert.Equal(t, 1, msg.RetryCount)
+}
+
+func TestTopic_GroupDeadLettersKeepPayloadAndAttributes(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+
+	group, err := topic.Subscribe("billing", gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 1})
+	require.NoError(t, err)
+	dlq := setupTestQueue(t)
+	group.RegisterDeadLetterQueue(dlq)
+
+	require.NoError(t, topic.PublishWithAttributes(ctx, []byte("invoice"), map[string]string{"tenant": "a"}))
+
+	for attempt := 0; attempt < 2; attempt++ {
+		msg, err := group.TryDequeue()
+		require.NoError(t, err)
+		require.NoError(t, group.NackWithReason(ctx, msg.ID, errors.New("payment service down")))
+		if attempt == 0 {
+			require.NoError(t, group.ExpireAck(msg.ID))
+		}
+	}
+	assertLen(t, group, 0)
+
+	dead, err := dlq.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "invoice", string(dead.Item))
+	assert.Equal(t, "a", dead.Attributes["tenant"])
+	assert.Equal(t, "2", dead.Attributes[gopq.DeadLetterAttemptsAttribute])
+	assert.Equal(t, "payment service down", dead.Attributes[gopq.DeadLetterLastErrorAttribute])
+	assert.Contains(t, dead.Attributes[gopq.DeadLetterQueueAttribute], "billing")
+}
+
+func TestTopic_SubscribeRejectsItemSettings(t *testing.T) {
+	topic := setupTestTopic(t)
+
+	for _, opts := range []gopq.CommonOpts{
+		{TTL: time.Minute},
+		{Compression: gopq.GzipCompressor{}},
+		{KeyFunc: func(item []byte) string { return string(item) }},
+		{Uniqueness: gopq.UniqueForLifetime},
+		{DedupeWindow: time.Hour},
+	} {
+		_, err := topic.Subscribe("group", gopq.AckOpts{AckTimeout: time.Minute, CommonOpts: opts})
+		assert.ErrorContains(t, err, "consumer groups do not support")
+	}
+
+	_, err := topic.Subscribe("group", gopq.AckOpts{AckTimeout: time.Minute, CommonOpts: gopq.CommonOpts{
+		Retention: gopq.RetentionPolicy{MaxProcessed: 10},
+	}})
+	assert.NoError(t, err)
+}
+
+func TestTopic_ProcessedMessagesAreDeleted(t *testing.T) {
+	path := tempFilePath(t)
+	topic, err := gopq.NewTopic(path)
+	require.NoError(t, err)
+	defer topic.Close()
+	ctx := context.Background()
+
+	marked, err := topic.Subscribe("marked", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	deleted, err := topic.Subscribe("deleted", gopq.AckOpts{AckTimeout: time.Minute, AckAction: gopq.AckDelete, MaxRetries: 0})
+	require.NoError(t, err)
+	dlq := setupTestQueue(t)
+	deleted.RegisterDeadLetterQueue(dlq)
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	assertMessages := func(expected int) {
+		t.Helper()
+		var count int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM topic_messages").Scan(&count))
+		assert.Equal(t, expected, count)
+	}
+
+	require.NoError(t, topic.Publish(ctx, []byte("acked")))
+	require.NoError(t, topic.Publish(ctx, []byte("dead")))
+	assertMessages(2)
+
+	acked := dequeueN(t, marked, 2)
+	for _, msg := range acked {
+		require.NoError(t, marked.Ack(msg.ID))
+	}
+	assertMessages(2)
+
+	msgs := dequeueN(t, deleted, 2)
+	require.NoError(t, deleted.Ack(msgs[0].ID))
+	assertMessages(1)
+	require.NoError(t, deleted.Nack(msgs[1].ID))
+	assertMessages(0)
+
+	dead, err := dlq.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "dead", string(dead.Item))
+
+	// The payload of a processed delivery is gone, so it cannot be
+	// delivered again.
+	var notFound *gopq.ErrMessageNotFound
+	assert.ErrorAs(t, marked.Requeue(ctx, acked[0].ID), &notFound)
+}
+
+func TestTopic_ConsumersOfAGroupShareMessages(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+	opts := gopq.AckOpts{AckTimeout: time.Minute}
+
+	first, err := topic.Subscribe("workers", opts)
+	require.NoError(t, err)
+	second, err := topic.Subscribe("workers", opts)
+	require.NoError(t, err)
+
+	require.NoError(t, topic.Publish(ctx, []byte("a")))
+	require.NoError(t, topic.Publish(ctx, []byte("b")))
+
+	msg, err := first.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Item))
+	msg, err = second.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(msg.Item))
+
+	_, err = first.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+}
+
+func TestTopic_SubscribersOnlySeeLaterMessages(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+
+	require.NoError(t, topic.Publish(ctx, []byte("dropped")))
+
+	group, err := topic.Subscribe("late", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+	assertLen(t, group, 0)
+
+	require.NoError(t, topic.Publish(ctx, []byte("seen")))
+	msg, err := group.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "seen", string(msg.Item))
+}
+
+func TestTopic_Unsubscribe(t *testing.T) {
+	topic := setupTestTopic(t)
+	ctx := context.Background()
+	opts := gopq.AckOpts{AckTimeout: time.Minute}
+
+	_, err := topic.Subscribe("group", opts)
+	require.NoError(t, err)
+	require.NoError(t, topic.Publish(ctx, []byte("item")))
+
+	require.NoError(t, topic.Unsubscribe(ctx, "group"))
+	require.NoError(t, topic.Unsubscribe(ctx, "unknown"))
+
+	group, err := topic.Subscribe("group", opts)
+	require.NoError(t, err)
+	assertLen(t, group, 0)
+}
+
+func TestTopic_GroupQueueRejectsEnqueue(t *testing.T) {
+	topic := setupTestTopic(t)
+
+	group, err := topic.Subscribe("group", gopq.AckOpts{})
+	require.NoError(t, err)
+
+	var unsupported *gopq.ErrUnsupported
+	err = group.TryEnqueue([]byte("item"))
+	assert.ErrorAs(t, err, &unsupported)
+
+	_, err = topic.Subscribe("not valid", gopq.AckOpts{})
+	assert.Error(t, err)
+}
+
+func TestTopic_BlockingDequeueWakesUp(t *testing.T) {
+	b, err := gopq.NewBroker("")
+	require.NoError(t, err)
+	defer b.Close()
+
+	publisher, err := b.Topic("events")
+	require.NoError(t, err)
+	subscriber, err := b.Topic("events")
+	require.NoError(t, err)
+
+	group, err := subscriber.Subscribe("group", gopq.AckOpts{AckTimeout: time.Minute})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan gopq.Msg)
+	go func() {
+		msg, err := group.DequeueCtx(ctx)
+		assert.NoError(t, err)
+		done <- msg
+	}()
+
+	require.NoError(t, publisher.Publish(ctx, []byte("event")))
+	msg := <-done
+	assert.Equal(t, "event", string(msg.Item))
+}
@@ -0,0 +1,215 @@
+package gopq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ttlLenExpiredQuery = `
+        SELECT COUNT(*) FROM %[1]s WHERE %[2]s
+    `
+	ttlAckSelectExpiredQuery = `
+        SELECT id AS position, id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
+        FROM %[1]s WHERE %[2]s
+        ORDER BY id
+    `
+	// The purge queries remove the single item ?2 if it is not NULL.
+	ttlPurgeExpiredQuery = `
+        DELETE FROM %[1]s WHERE %[2]s AND (?2 IS NULL OR id = ?2)
+        RETURNING id AS position, id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
+    `
+	ttlAckPurgeExpiredQuery = `
+        DELETE FROM %[1]s WHERE %[2]s AND (?2 IS NULL OR id = ?2)
+        RETURNING id AS position, id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
+    `
+
+	// Conditions selecting the expired items of each kind of queue. Items
+	// waiting for an acknowledgement are not expired until their ack
+	// deadline has passed as well.
+	expiredCondition          = "processed_at IS NULL AND expires_at <= ?1"
+	uniqueExpiredCondition    = "expires_at <= ?1"
+	ackExpiredCondition       = "processed_at IS NULL AND (ack_deadline IS NULL OR ack_deadline < ?1) AND expires_at <= ?1"
+	uniqueAckExpiredCondition = "(ack_deadline IS NULL OR ack_deadline < ?1) AND expires_at <= ?1"
+)
+
+// EnqueueWithTTL adds an item to the queue that expires after the given
+// time-to-live. Expired items are never dequeued and are not counted by Len.
+// It overrides the queue's default time-to-live; a ttl of zero means the
+// item never expires.
+// It returns an error if the operation fails or the context is cancelled.
+func (q *Queue) EnqueueWithTTL(ctx context.Context, item []byte, ttl time.Duration) error {
+	return retryWhileLocked(ctx, defaultPollInterval, func(ctx context.Context) error {
+		return q.TryEnqueueWithTTL(ctx, item, ttl)
+	})
+}
+
+// TryEnqueueWithTTL attempts to add an item to the queue that expires after
+// the given time-to-live.
+// This is non-blocking, and will return immediately.
+func (q *Queue) TryEnqueueWithTTL(ctx context.Context, item []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("time-to-live must not be negative: %v", ttl)
+	}
+	if q.queries.enqueue == "" {
+		return &ErrUnsupported{Op: "EnqueueWithTTL"}
+	}
+	return q.tryEnqueue(ctx, q.queries.enqueue, item, q.expiresAt(ttl))
+}
+
+// LenExpired returns the number of expired items that are still stored in
+// the queue. Expired items are removed in the background if the queue has a
+// default time-to-live or a retention policy, or right away with
+// PurgeExpired.
+func (q *Queue) LenExpired() (int, error) {
+	if q.queries.lenExpired == "" {
+		return 0, &ErrUnsupported{Op: "LenExpired"}
+	}
+	row := q.db.QueryRow(q.queries.lenExpired, q.now())
+	var count int
+	err := row.Scan(&count)
+	return count, err
+}
+
+// PurgeExpired removes all expired items from the queue and returns them.
+// Acknowledgeable queues hand the items to their ExpiredCallbacks, and to
+// their FailureCallbacks if ExpireAsFailure is set, before removing them.
+// Items whose callbacks fail are kept, to be purged again later, and their
+// errors are returned along with the items that were removed. Items waiting
+// for an acknowledgement are not removed until their ack deadline has
+// passed. Queues with a default time-to-live or a retention policy also
+// purge expired items in the background, at the interval of their retention
+// policy.
+func (q *Queue) PurgeExpired(ctx context.Context) ([]Msg, error) {
+	if q.queries.purgeExpired == "" {
+		return nil, &ErrUnsupported{Op: "PurgeExpired"}
+	}
+	now := q.now()
+	if q.onExpired == nil {
+		return q.purgeExpired(ctx, q.db, now, nil)
+	}
+
+	rows, err := q.db.QueryContext(ctx, q.queries.selectExpired, now)
+	expired, err := q.handleDequeueBatchResult(rows, err)
+	if _, ok := err.(*ErrNoItemsWaiting); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The callbacks run outside of a transaction, since they may write to
+	// the same database, and the items are only removed once they
+	// succeeded. Removing an item checks again that it is still expired.
+	var (
+		purged []Msg
+		errs   []error
+	)
+	for _, msg := range expired {
+		if err := q.onExpired(msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge expired message %d: %w", msg.ID, err))
+			continue
+		}
+		removed, err := q.purgeExpired(ctx, q.db, now, msg.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge expired message %d: %w", msg.ID, err))
+			continue
+		}
+		purged = append(purged, removed...)
+	}
+	return purged, errors.Join(errs...)
+}
+
+// queryer runs queries on a database or within a transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// purgeExpired removes the items of the queue that were expired at now and
+// returns them, without running any callbacks. If id is not nil, only the
+// item with that id is removed.
+func (q *Queue) purgeExpired(ctx context.Context, db queryer, now int64, id any) ([]Msg, error) {
+	rows, err := db.QueryContext(ctx, q.queries.purgeExpired, now, id)
+	msgs, err := q.handleDequeueBatchResult(rows, err)
+	if _, ok := err.(*ErrNoItemsWaiting); ok {
+		return nil, nil
+	}
+	return msgs, err
+}
+
+// purgeExpiredTx removes the expired items of a unique queue within tx
+// before new items are enqueued, since an expired item would otherwise
+// refuse its duplicates until it is purged. Other queues purge nothing, and
+// so do queues with expired callbacks, which purgeExpiredFirst handles.
+func (q *Queue) purgeExpiredTx(ctx context.Context, tx *sql.Tx) error {
+	if !q.mode.is(modeKeyed) || q.queries.purgeExpired == "" || q.onExpired != nil {
+		return nil
+	}
+	_, err := q.purgeExpired(ctx, tx, q.now(), nil)
+	return err
+}
+
+// purgeExpiredFirst removes the expired items of a unique queue with
+// expired callbacks before new items are enqueued. The callbacks cannot run
+// within the enqueue transaction, so the items are purged before it starts.
+func (q *Queue) purgeExpiredFirst(ctx context.Context) error {
+	if !q.mode.is(modeKeyed) || q.queries.purgeExpired == "" || q.onExpired == nil {
+		return nil
+	}
+	_, err := q.PurgeExpired(ctx)
+	return err
+}
+
+// runExpiredCallback hands an expired item to the callbacks registered for
+// expired messages.
+func (q *AcknowledgeableQueue) runExpiredCallback(msg Msg) error {
+	return runExpiredCallbacks(q.AckOpts, q.name, msg)
+}
+
+// RegisterOnExpiredCallback adds a callback to the queue that is called when
+// an expired message is removed.
+func (q *AcknowledgeableQueue) RegisterOnExpiredCallback(fn func(msg Msg) error) {
+	q.ExpiredCallbacks = append(q.ExpiredCallbacks, fn)
+}
+
+// runExpiredCallbacks hands an expired message of the given queue to the
+// registered callbacks.
+func runExpiredCallbacks(opts AckOpts, queue string, msg Msg) error {
+	for _, fn := range opts.ExpiredCallbacks {
+		err := fn(msg)
+		if err != nil {
+			return fmt.Errorf("failed to execute expired callback: %w", err)
+		}
+	}
+	if opts.ExpireAsFailure {
+		return runFailureCallbacks(opts, DeadLetter{
+			Msg:       msg,
+			Queue:     queue,
+			Attempts:  msg.RetryCount,
+			LastError: expiredReason,
+		})
+	}
+	return nil
+}
+
+// expiresAt returns the expiry time of an item enqueued now with the given
+// time-to-live, or NULL if the item does not expire.
+func (q *Queue) expiresAt(ttl time.Duration) sql.NullInt64 {
+	return q.expiresAfter(q.opts.Clock.Now(), ttl)
+}
+
+// expiresAfter returns the expiry time of an item that becomes visible at
+// the given time, or now if that has passed. The time-to-live of delayed
+// items only starts once they become visible.
+func (q *Queue) expiresAfter(visibleAt time.Time, ttl time.Duration) sql.NullInt64 {
+	if ttl <= 0 {
+		return sql.NullInt64{}
+	}
+	if now := q.opts.Clock.Now(); now.After(visibleAt) {
+		visibleAt = now
+	}
+	return sql.NullInt64{Int64: visibleAt.Add(ttl).UnixMilli(), Valid: true}
+}
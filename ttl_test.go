@@ -0,0 +1,335 @@
+package gopq_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
+)
+
+func TestQueue_ExpiredItemsAreNotDequeued(t *testing.T) {
+	q, err := gopq.NewSimpleQueue(tempFilePath(t), gopq.WithTTL(time.Second))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("expires")))
+	require.NoError(t, q.EnqueueWithTTL(ctx, []byte("forever"), 0))
+	require.NoError(t, q.EnqueueWithTTL(ctx, []byte("later"), time.Hour))
+
+	length, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 3, length)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	length, err = q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, length)
+	expired, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "forever", string(msg.Item))
+
+	msgs, err := q.PurgeExpired(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "expires", string(msgs[0].Item))
+
+	expired, err = q.LenExpired()
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "later", string(msg.Item))
+}
+
+func TestAckQueue_ExpiredItemsAreRouted(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout:      time.Hour,
+		ExpireAsFailure: true,
+		CommonOpts: gopq.CommonOpts{
+			TTL: time.Second,
+		},
+	})
+	dlq := setupTestQueue(t)
+	q.RegisterDeadLetterQueue(dlq)
+
+	var expired []string
+	q.RegisterOnExpiredCallback(func(msg gopq.Msg) error {
+		expired = append(expired, string(msg.Item))
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(t, q.EnqueueWithAttributes(ctx, []byte("item"), map[string]string{"tenant": "a"}))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	_, err := q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+	assertLen(t, q, 0)
+
+	msgs, err := q.PurgeExpired(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, []string{"item"}, expired)
+
+	msg, err := dlq.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(msg.Item))
+	assert.Equal(t, "a", msg.Attributes["tenant"])
+}
+
+func TestAckQueue_InFlightItemsDoNotExpire(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Hour, CommonOpts: gopq.CommonOpts{TTL: time.Second}})
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	msgs, err := q.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.NoError(t, q.Ack(msg.ID))
+}
+
+func TestUniqueQueue_PurgedItemsCanBeEnqueuedAgain(t *testing.T) {
+	q := setupTestUniqueQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueWithTTL(ctx, []byte("item"), time.Second))
+	time.Sleep(1100 * time.Millisecond)
+
+	msgs, err := q.PurgeExpired(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "item", string(msg.Item))
+}
+
+func TestUniqueQueue_ExpiredItemsDoNotBlockDuplicates(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q, err := gopq.NewUniqueQueue(tempFilePath(t), gopq.WithTTL(time.Second), gopq.WithClock(clock))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("x")))
+	require.NoError(t, q.EnqueueWithKey(ctx, "key", []byte("keyed")))
+	clock.Advance(2 * time.Second)
+
+	require.NoError(t, q.Enqueue([]byte("x")))
+	require.NoError(t, q.EnqueueWithKey(ctx, "key", []byte("keyed")))
+	assertQueueLen(t, q, 2)
+	expired, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+
+	msgs := dequeueN(t, q, 2)
+	assert.Equal(t, []string{"x", "keyed"}, items(msgs))
+}
+
+func TestUniqueAckQueue_ExpiredItemsArePurgedOnEnqueue(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestUniqueAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, CommonOpts: gopq.CommonOpts{TTL: time.Second, Clock: clock}})
+
+	var expired []string
+	q.RegisterOnExpiredCallback(func(msg gopq.Msg) error {
+		expired = append(expired, string(msg.Item))
+		return nil
+	})
+
+	require.NoError(t, q.Enqueue([]byte("x")))
+	clock.Advance(2 * time.Second)
+
+	require.NoError(t, q.Enqueue([]byte("x")))
+	assert.Equal(t, []string{"x"}, expired)
+	assertLen(t, q, 1)
+
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(msg.Item))
+}
+
+func TestAckQueue_ExpiredItemsArePurgedInBackground(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		CommonOpts: gopq.CommonOpts{
+			TTL:       time.Second,
+			Clock:     clock,
+			Retention: gopq.RetentionPolicy{Interval: 10 * time.Millisecond},
+		},
+	})
+	defer q.Close()
+
+	var mu sync.Mutex
+	var expired []string
+	q.RegisterOnExpiredCallback(func(msg gopq.Msg) error {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = append(expired, string(msg.Item))
+		return nil
+	})
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	clock.Advance(2 * time.Second)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(expired) == 1
+	}, time.Second, 10*time.Millisecond)
+	n, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestAckQueue_FailedExpiredCallbacksKeepItems(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		CommonOpts: gopq.CommonOpts{
+			TTL:   time.Second,
+			Clock: clock,
+		},
+	})
+
+	fail := true
+	var expired []string
+	q.RegisterOnExpiredCallback(func(msg gopq.Msg) error {
+		if fail {
+			return errors.New("dead letter store unavailable")
+		}
+		expired = append(expired, string(msg.Item))
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(t, q.Enqueue([]byte("item")))
+	clock.Advance(2 * time.Second)
+
+	msgs, err := q.PurgeExpired(ctx)
+	assert.Error(t, err)
+	assert.Empty(t, msgs)
+	n, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	fail = false
+	msgs, err = q.PurgeExpired(ctx)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, []string{"item"}, expired)
+	n, err = q.LenExpired()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestAckQueue_BackgroundErrorsAreReported(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	errs := make(chan error, 10)
+	q := setupTestAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		CommonOpts: gopq.CommonOpts{
+			TTL:       time.Second,
+			Clock:     clock,
+			Retention: gopq.RetentionPolicy{Interval: 10 * time.Millisecond},
+			OnBackgroundError: func(err error) {
+				select {
+				case errs <- err:
+				default:
+				}
+			},
+		},
+	})
+	defer q.Close()
+
+	q.RegisterOnExpiredCallback(func(msg gopq.Msg) error {
+		return errors.New("dead letter store unavailable")
+	})
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	clock.Advance(2 * time.Second)
+
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "dead letter store unavailable")
+	case <-time.After(time.Second):
+		t.Fatal("background error was not reported")
+	}
+	n, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestQueue_NoBackgroundPurgeWithoutTTLOrRetention(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q, err := gopq.NewSimpleQueue("",
+		gopq.WithClock(clock),
+		gopq.WithRetention(gopq.RetentionPolicy{Interval: 10 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+	defer q.Close()
+
+	ctx := context.Background()
+	require.NoError(t, q.EnqueueWithTTL(ctx, []byte("item"), time.Second))
+	clock.Advance(2 * time.Second)
+	time.Sleep(50 * time.Millisecond)
+
+	n, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	msgs, err := q.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 1)
+}
+
+func TestQueue_NegativeTTL(t *testing.T) {
+	_, err := gopq.NewSimpleQueue("", gopq.WithTTL(-time.Second))
+	assert.Error(t, err)
+
+	q := setupTestQueue(t)
+	assert.Error(t, q.EnqueueWithTTL(context.Background(), []byte("item"), -time.Second))
+}
+
+func TestQueue_TTLStartsWhenDelayedItemBecomesVisible(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q, err := gopq.NewSimpleQueue(tempFilePath(t), gopq.WithTTL(time.Minute), gopq.WithClock(clock))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("delayed"), time.Hour))
+
+	clock.Advance(time.Hour + 30*time.Second)
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "delayed", string(msg.Item))
+
+	require.NoError(t, q.EnqueueAfter(ctx, []byte("stale"), time.Hour))
+	clock.Advance(time.Hour + 2*time.Minute)
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+	n, err := q.LenExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
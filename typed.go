@@ -0,0 +1,223 @@
+package gopq
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Codec converts values of type T to and from the items stored in a queue.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(item []byte) (T, error)
+}
+
+// JSONCodec encodes values as JSON.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(item []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(item, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob. Every item carries its own
+// type information, so items can be decoded in any order.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(item []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(item)).Decode(&v)
+	return v, err
+}
+
+// BytesCodec stores raw bytes unchanged.
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (BytesCodec) Decode(item []byte) ([]byte, error) {
+	return item, nil
+}
+
+// ErrDecode is returned for a message whose item could not be decoded.
+// Acknowledgeable queues have negatively acknowledged the message by then,
+// so it is retried or dead lettered like any other failure. Other queues
+// have already removed the message, and Msg holds its only copy.
+type ErrDecode struct {
+	Msg Msg
+	Err error
+}
+
+func (e *ErrDecode) Error() string {
+	return fmt.Sprintf("failed to decode message %d: %v", e.Msg.ID, e.Err)
+}
+
+func (e *ErrDecode) Unwrap() error {
+	return e.Err
+}
+
+// TypedMsg is a message together with its decoded item.
+type TypedMsg[T any] struct {
+	Msg
+	Value T
+}
+
+// Typed wraps a queue to enqueue and dequeue values of type T, which are
+// converted to and from items by a Codec.
+type Typed[T any] struct {
+	queue Queuer
+	codec Codec[T]
+}
+
+// NewTyped creates a typed view of queue that converts values with codec.
+// Use an acknowledgeable queue to keep messages that fail to decode: other
+// queues remove a message when it is dequeued, so it is lost unless the
+// caller keeps the item of the returned ErrDecode.
+func NewTyped[T any](queue Queuer, codec Codec[T]) *Typed[T] {
+	return &Typed[T]{queue: queue, codec: codec}
+}
+
+// Queue returns the wrapped queue.
+func (q *Typed[T]) Queue() Queuer {
+	return q.queue
+}
+
+// Enqueue encodes v and adds it to the queue.
+// It returns an error if the encoding or the operation fails.
+func (q *Typed[T]) Enqueue(ctx context.Context, v T) error {
+	item, err := q.encode(v)
+	if err != nil {
+		return err
+	}
+	return q.queue.EnqueueCtx(ctx, item)
+}
+
+// TryEnqueue encodes v and attempts to add it to the queue.
+// This is non-blocking, and will return immediately.
+func (q *Typed[T]) TryEnqueue(ctx context.Context, v T) error {
+	item, err := q.encode(v)
+	if err != nil {
+		return err
+	}
+	return q.queue.TryEnqueueCtx(ctx, item)
+}
+
+// Dequeue blocks until a message is available and returns it with its
+// decoded item. If the item cannot be decoded, it returns an ErrDecode.
+func (q *Typed[T]) Dequeue(ctx context.Context) (TypedMsg[T], error) {
+	msg, err := q.queue.DequeueCtx(ctx)
+	if err != nil {
+		return TypedMsg[T]{}, err
+	}
+	return q.decode(ctx, msg)
+}
+
+// TryDequeue attempts to return the next message with its decoded item.
+// This is non-blocking, and will return immediately.
+func (q *Typed[T]) TryDequeue(ctx context.Context) (TypedMsg[T], error) {
+	msg, err := q.queue.TryDequeueCtx(ctx)
+	if err != nil {
+		return TypedMsg[T]{}, err
+	}
+	return q.decode(ctx, msg)
+}
+
+// Ack acknowledges a message of an acknowledgeable queue. Other queues
+// return ErrUnsupported.
+func (q *Typed[T]) Ack(id int64) error {
+	acker, ok := q.queue.(AckableQueue)
+	if !ok {
+		return &ErrUnsupported{Op: "Ack"}
+	}
+	return acker.Ack(id)
+}
+
+// Nack negatively acknowledges a message of an acknowledgeable queue.
+// Other queues return ErrUnsupported.
+func (q *Typed[T]) Nack(id int64) error {
+	acker, ok := q.queue.(AckableQueue)
+	if !ok {
+		return &ErrUnsupported{Op: "Nack"}
+	}
+	return acker.Nack(id)
+}
+
+// NackWithReason negatively acknowledges a message of an acknowledgeable
+// queue and adds err to its failure history. Other queues return
+// ErrUnsupported.
+func (q *Typed[T]) NackWithReason(ctx context.Context, id int64, err error) error {
+	nacker, ok := q.queue.(reasonNacker)
+	if !ok {
+		return &ErrUnsupported{Op: "NackWithReason"}
+	}
+	return nacker.NackWithReason(ctx, id, err)
+}
+
+// Close closes the wrapped queue.
+func (q *Typed[T]) Close() error {
+	return q.queue.Close()
+}
+
+// encode converts v to an item.
+func (q *Typed[T]) encode(v T) ([]byte, error) {
+	item, err := q.codec.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode item: %w", err)
+	}
+	return item, nil
+}
+
+// decode converts the item of msg to a value. Messages that cannot be
+// decoded are negatively acknowledged with the error as the reason.
+func (q *Typed[T]) decode(ctx context.Context, msg Msg) (TypedMsg[T], error) {
+	v, err := q.codec.Decode(msg.Item)
+	if err == nil {
+		return TypedMsg[T]{Msg: msg, Value: v}, nil
+	}
+
+	decodeErr := &ErrDecode{Msg: msg, Err: err}
+	var nackErr error
+	switch queue := q.queue.(type) {
+	case reasonNacker:
+		nackErr = queue.NackWithReason(ctx, msg.ID, decodeErr)
+	case AckableQueue:
+		nackErr = queue.Nack(msg.ID)
+	}
+	if nackErr != nil {
+		return TypedMsg[T]{}, errors.Join(decodeErr, fmt.Errorf("failed to nack message %d: %w", msg.ID, nackErr))
+	}
+	return TypedMsg[T]{}, decodeErr
+}
+
+// TypedHandler returns a Handler for a Consumer that decodes the item of
+// every message with codec before passing it to fn. Messages that cannot
+// be decoded fail with an ErrDecode, so the consumer negatively
+// acknowledges them and they end up in the dead letter queue once their
+// retries are exhausted.
+func TypedHandler[T any](codec Codec[T], fn func(ctx context.Context, msg TypedMsg[T]) error) Handler {
+	return func(ctx context.Context, msg Msg) error {
+		v, err := codec.Decode(msg.Item)
+		if err != nil {
+			return &ErrDecode{Msg: msg, Err: err}
+		}
+		return fn(ctx, TypedMsg[T]{Msg: msg, Value: v})
+	}
+}
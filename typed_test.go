@@ -0,0 +1,137 @@
+package gopq_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+)
+
+type reindexJob struct {
+	DocumentID string
+	Priority   int
+}
+
+func TestTyped_Codecs(t *testing.T) {
+	ctx := context.Background()
+	job := reindexJob{DocumentID: "doc-42", Priority: 3}
+
+	jsonQueue := gopq.NewTyped[reindexJob](setupTestQueue(t), gopq.JSONCodec[reindexJob]{})
+	require.NoError(t, jsonQueue.Enqueue(ctx, job))
+	msg, err := jsonQueue.TryDequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, job, msg.Value)
+	assert.JSONEq(t, `{"DocumentID":"doc-42","Priority":3}`, string(msg.Item))
+
+	gobQueue := gopq.NewTyped[reindexJob](setupTestQueue(t), gopq.GobCodec[reindexJob]{})
+	require.NoError(t, gobQueue.TryEnqueue(ctx, job))
+	require.NoError(t, gobQueue.TryEnqueue(ctx, reindexJob{DocumentID: "doc-43"}))
+	msg, err = gobQueue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, job, msg.Value)
+	msg, err = gobQueue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "doc-43", msg.Value.DocumentID)
+
+	bytesQueue := gopq.NewTyped[[]byte](setupTestQueue(t), gopq.BytesCodec{})
+	require.NoError(t, bytesQueue.Enqueue(ctx, []byte("raw")))
+	raw, err := bytesQueue.TryDequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(raw.Value))
+
+	var unsupported *gopq.ErrUnsupported
+	assert.ErrorAs(t, bytesQueue.Ack(raw.ID), &unsupported)
+}
+
+func TestTyped_DecodeFailureIsDeadLettered(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	dlq := setupTestQueue(t)
+	q.RegisterDeadLetterQueue(dlq)
+	ctx := context.Background()
+
+	typed := gopq.NewTyped[reindexJob](q, gopq.JSONCodec[reindexJob]{})
+	require.NoError(t, q.Enqueue([]byte("not json")))
+	require.NoError(t, typed.Enqueue(ctx, reindexJob{DocumentID: "doc-1"}))
+
+	_, err := typed.TryDequeue(ctx)
+	var decodeErr *gopq.ErrDecode
+	require.ErrorAs(t, err, &decodeErr)
+	assert.Equal(t, "not json", string(decodeErr.Msg.Item))
+
+	// The bad payload was moved to the dead letter queue...
+	msg, err := dlq.TryDequeue()
+	require.NoError(t, err)
+	dl, err := gopq.ParseDeadLetter(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "not json", string(dl.Item))
+	assert.Contains(t, dl.LastError, "failed to decode message")
+
+	// ...and the next message is processed as usual.
+	job, err := typed.TryDequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "doc-1", job.Value.DocumentID)
+	require.NoError(t, typed.Ack(job.ID))
+	assertLen(t, q, 0)
+}
+
+func TestTypedHandler(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	ctx := context.Background()
+
+	dead := make(chan gopq.DeadLetter, 1)
+	q.RegisterOnDeadLetterCallback(func(dl gopq.DeadLetter) error {
+		dead <- dl
+		return nil
+	})
+	handled := make(chan reindexJob, 1)
+	codec := gopq.JSONCodec[reindexJob]{}
+
+	require.NoError(t, q.Enqueue([]byte("{")))
+	require.NoError(t, gopq.NewTyped[reindexJob](q, codec).Enqueue(ctx, reindexJob{DocumentID: "doc-7"}))
+
+	stop := runConsumer(t, gopq.NewConsumer(q, gopq.TypedHandler(codec, func(ctx context.Context, msg gopq.TypedMsg[reindexJob]) error {
+		handled <- msg.Value
+		return nil
+	}), gopq.ConsumerOpts{}))
+	defer stop()
+
+	select {
+	case dl := <-dead:
+		assert.Equal(t, "{", string(dl.Item))
+	case <-time.After(5 * time.Second):
+		t.Fatal("bad payload was not dead lettered")
+	}
+	select {
+	case job := <-handled:
+		assert.Equal(t, "doc-7", job.DocumentID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not handled")
+	}
+}
+
+func TestTyped_NackWithReason(t *testing.T) {
+	q := setupTestAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 0})
+	var dead gopq.DeadLetter
+	q.RegisterOnDeadLetterCallback(func(dl gopq.DeadLetter) error {
+		dead = dl
+		return nil
+	})
+	ctx := context.Background()
+
+	typed := gopq.NewTyped[reindexJob](q, gopq.JSONCodec[reindexJob]{})
+	require.NoError(t, typed.Enqueue(ctx, reindexJob{DocumentID: "doc-1"}))
+	job, err := typed.TryDequeue(ctx)
+	require.NoError(t, err)
+	require.NoError(t, typed.NackWithReason(ctx, job.ID, errors.New("document is locked")))
+	assert.Equal(t, "document is locked", dead.LastError)
+
+	// Queues without acknowledgements cannot nack.
+	plain := gopq.NewTyped[reindexJob](setupTestQueue(t), gopq.JSONCodec[reindexJob]{})
+	var unsupported *gopq.ErrUnsupported
+	assert.ErrorAs(t, plain.NackWithReason(ctx, 1, errors.New("reason")), &unsupported)
+}
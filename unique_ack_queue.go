@@ -1,36 +1,69 @@
 package gopq
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/mattdeak/gopq/internal"
 )
 
 const (
-	uniqueAckCreateTableQuery = `
+	// Messages are unique by their deduplication key, or by their content
+	// if they have none.
+	uniqueAckTableQuery = `
 		CREATE TABLE IF NOT EXISTS %[1]s (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			item BLOB NOT NULL,
-			enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			enqueued_at INTEGER,
+			processed_at TIMESTAMP,
 			ack_deadline INTEGER,
 			retry_count INTEGER DEFAULT 0,
-			UNIQUE(item) ON CONFLICT IGNORE
+			visible_at INTEGER,
+			attributes TEXT,
+			expires_at INTEGER,
+			first_attempt_at INTEGER,
+			last_attempt_at INTEGER,
+			failures TEXT,
+			dedupe_key TEXT,
+			codec TEXT,
+			unique_key BLOB GENERATED ALWAYS AS (COALESCE(dedupe_key, item)) VIRTUAL,
+			UNIQUE(unique_key) ON CONFLICT IGNORE
 		);
-		CREATE INDEX IF NOT EXISTS idx_ack_deadline ON %[1]s(ack_deadline);
+	`
+	uniqueAckCreateTableQuery = uniqueAckTableQuery + `
+		CREATE INDEX IF NOT EXISTS idx_%[1]s_processed ON %[1]s(processed_at);
+		CREATE INDEX IF NOT EXISTS idx_%[1]s_ack_deadline ON %[1]s(ack_deadline);
+		CREATE INDEX IF NOT EXISTS idx_%[1]s_visible_at ON %[1]s(visible_at);
+		CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s(expires_at);
 	`
 	uniqueAckEnqueueQuery = `
-		INSERT INTO %s (item) VALUES (?)
+		INSERT INTO %s (item, expires_at, dedupe_key, codec, enqueued_at) VALUES (?, ?, ?, ?, ?)
 	`
 	uniqueAckTryDequeueQuery = `
 		WITH oldest AS (
 			SELECT id, item
 			FROM %[1]s
-			WHERE (ack_deadline < ? OR ack_deadline IS NULL)
-			ORDER BY enqueued_at ASC
+			WHERE (ack_deadline < ?1 OR ack_deadline IS NULL)
+				AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
 			LIMIT 1
 		)
-		UPDATE %[1]s SET ack_deadline = ? WHERE id = (SELECT id FROM oldest)
-		RETURNING id, item
+		UPDATE %[1]s SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1 WHERE id = (SELECT id FROM oldest)
+		RETURNING id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
+	`
+	uniqueAckTryDequeueBatchQuery = `
+		WITH batch AS MATERIALIZED (
+			SELECT id, row_number() OVER (ORDER BY enqueued_at ASC, id ASC) AS position
+			FROM %[1]s
+			WHERE (ack_deadline < ?1 OR ack_deadline IS NULL)
+				AND (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
+			LIMIT ?3
+		)
+		UPDATE %[1]s SET ack_deadline = ?2, first_attempt_at = COALESCE(first_attempt_at, ?1), last_attempt_at = ?1 WHERE id IN (SELECT id FROM batch)
+		RETURNING (SELECT position FROM batch WHERE batch.id = %[1]s.id), id, item, attributes, CAST(enqueued_at AS INTEGER), retry_count, ack_deadline, codec
 	`
 	uniqueAckAckQuery = `
 		DELETE FROM %s 
@@ -38,7 +71,9 @@ const (
 	`
 	uniqueAckLenQuery = `
 		SELECT COUNT(*) FROM %s
-		WHERE ack_deadline IS NULL OR ack_deadline < ?
+		WHERE (ack_deadline IS NULL OR ack_deadline < ?1)
+			AND (visible_at IS NULL OR visible_at <= ?1)
+			AND (expires_at IS NULL OR expires_at > ?1)
 	`
 )
 
@@ -49,38 +84,107 @@ func NewUniqueAckQueue(filePath string, opts AckOpts) (*AcknowledgeableQueue, er
 		return nil, fmt.Errorf("failed to create unique ack queue: %w", err)
 	}
 	tableName := internal.DetermineTableName("unique_ack_queue", filePath)
+	return newUniqueAckQueue(db, tableName, internal.MakeNotifyChan(), opts)
+}
+
+// newUniqueAckQueue creates a unique ack queue in the given table of db.
+func newUniqueAckQueue(db *sql.DB, tableName string, notifyChan chan struct{}, opts AckOpts) (*AcknowledgeableQueue, error) {
+	templates, ok := uniqueAckQueueTemplates[opts.Uniqueness]
+	if !ok {
+		return nil, fmt.Errorf("failed to create unique ack queue: unknown uniqueness %d", opts.Uniqueness)
+	}
+	retention, err := uniqueRetention(opts.Uniqueness, opts.DedupeWindow, opts.Retention)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique ack queue: %w", err)
+	}
 
 	formattedCreateTableQuery := fmt.Sprintf(uniqueAckCreateTableQuery, tableName)
 	formattedEnqueueQuery := fmt.Sprintf(uniqueAckEnqueueQuery, tableName)
-	formattedTryDequeueQuery := fmt.Sprintf(uniqueAckTryDequeueQuery, tableName)
-	formattedAckQuery := fmt.Sprintf(uniqueAckAckQuery, tableName)
-	formattedLenQuery := fmt.Sprintf(uniqueAckLenQuery, tableName)
+	formattedTryDequeueQuery := fmt.Sprintf(templates.tryDequeue, tableName)
+	formattedTryDequeueBatchQuery := fmt.Sprintf(templates.tryDequeueBatch, tableName)
+	formattedAckQuery := fmt.Sprintf(templates.ack, tableName)
+	formattedLenQuery := fmt.Sprintf(templates.len, tableName)
+	formattedEnqueueAtQuery := fmt.Sprintf(uniqueDelayedEnqueueQuery, tableName)
+	formattedEnqueueAttributesQuery := fmt.Sprintf(uniqueAttributesEnqueueQuery, tableName)
+	formattedNextVisibleQuery := fmt.Sprintf(templates.nextVisible, tableName)
+	formattedLenExpiredQuery := fmt.Sprintf(ttlLenExpiredQuery, tableName, templates.expiredCondition)
+	formattedSelectExpiredQuery := fmt.Sprintf(ttlAckSelectExpiredQuery, tableName, templates.expiredCondition)
+	formattedPurgeExpiredQuery := fmt.Sprintf(ttlAckPurgeExpiredQuery, tableName, templates.expiredCondition)
+	formattedPeekQuery := fmt.Sprintf(browseAckQuery, tableName, templates.readyCondition, fifoOrder)
+	formattedBrowseQuery := fmt.Sprintf(browseAckQuery, tableName, templates.pendingCondition, fifoOrder)
+	formattedDeleteByIDQuery := fmt.Sprintf(adminDeleteQuery, tableName)
+	formattedPurgePendingQuery := fmt.Sprintf(adminPurgeQuery, tableName, templates.purgeFilter)
+	formattedPurgeAllQuery := fmt.Sprintf(adminPurgeQuery, tableName, "")
+	formattedRequeueQuery := fmt.Sprintf(adminRequeueQuery, tableName, templates.requeueSet)
+	formattedCompactAgeQuery := fmt.Sprintf(compactAgeQuery, tableName)
+
+	common, err := opts.CommonOpts.resolve()
+	if err != nil {
+		return nil, err
+	}
+	common.Retention = retention
+
+	err = internal.MigrateTable(db, tableName, uniqueAckAddedColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique ack queue: %w", err)
+	}
+	err = internal.MigrateMillis(db, tableName, millisColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique ack queue: %w", err)
+	}
+	err = internal.RebuildTable(db, tableName, dedupeKeyColumn, uniqueAckTableQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique ack queue: %w", err)
+	}
 
-	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedAckQuery, formattedLenQuery)
+	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedTryDequeueBatchQuery, formattedAckQuery, formattedLenQuery, formattedEnqueueAtQuery, formattedEnqueueAttributesQuery, formattedNextVisibleQuery, formattedLenExpiredQuery, formattedSelectExpiredQuery, formattedPurgeExpiredQuery, formattedPeekQuery, formattedBrowseQuery, formattedDeleteByIDQuery, formattedPurgePendingQuery, formattedPurgeAllQuery, formattedRequeueQuery, formattedCompactAgeQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create unique ack queue: %w", err)
 	}
 
-	return &AcknowledgeableQueue{
+	q := &AcknowledgeableQueue{
 		Queue: Queue{
 			db:           db,
+			name:         tableName,
 			pollInterval: defaultPollInterval,
-			notifyChan:   internal.MakeNotifyChan(),
+			notifyChan:   notifyChan,
 			queries: baseQueries{
-				enqueue:    formattedEnqueueQuery,
-				tryDequeue: formattedTryDequeueQuery,
-				len:        formattedLenQuery,
+				enqueue:           formattedEnqueueQuery,
+				enqueueAt:         formattedEnqueueAtQuery,
+				enqueueAttributes: formattedEnqueueAttributesQuery,
+				tryDequeue:        formattedTryDequeueQuery,
+				tryDequeueBatch:   formattedTryDequeueBatchQuery,
+				len:               formattedLenQuery,
+				nextVisible:       formattedNextVisibleQuery,
+				lenExpired:        formattedLenExpiredQuery,
+				selectExpired:     formattedSelectExpiredQuery,
+				purgeExpired:      formattedPurgeExpiredQuery,
+				peek:              formattedPeekQuery,
+				browse:            formattedBrowseQuery,
+				deleteByID:        formattedDeleteByIDQuery,
+				purgePending:      formattedPurgePendingQuery,
+				purgeAll:          formattedPurgeAllQuery,
+				requeue:           formattedRequeueQuery,
+				compactAge:        formattedCompactAgeQuery,
+				vacuum:            compactVacuumQuery,
 			},
+			opts: common,
+			mode: modeKeyed | modeCodec,
 		},
 		AckOpts: opts,
 		ackQueries: ackQueries{
 			ack: formattedAckQuery,
 			ackUtilsQueries: ackUtilsQueries{
-				details:  fmt.Sprintf(sqlite.details, tableName),
-				delete:   fmt.Sprintf(sqlite.delete, tableName),
-				forRetry: fmt.Sprintf(sqlite.forRetry, tableName),
-				expire:   fmt.Sprintf(sqlite.expire, tableName),
+				details:       fmt.Sprintf(sqlite.details, tableName),
+				delete:        fmt.Sprintf(sqlite.delete, tableName),
+				forRetry:      fmt.Sprintf(sqlite.forRetry, tableName),
+				expire:        fmt.Sprintf(sqlite.expire, tableName),
+				extend:        fmt.Sprintf(sqlite.extend, tableName),
+				recordFailure: fmt.Sprintf(sqlite.recordFailure, tableName),
 			},
 		},
-	}, nil
+	}
+	q.onExpired = q.runExpiredCallback
+	q.startJanitor()
+	return q, nil
 }
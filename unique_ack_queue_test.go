@@ -208,7 +208,7 @@ func TestUniqueAckQueue_Len_AfterNack(t *testing.T) {
 }
 
 func TestUniqueAckQueue_Len_AfterMaxRetries(t *testing.T) {
-	q := setupTestUniqueAckQueue(t, gopq.AckOpts{MaxRetries: 1, RetryBackoff: time.Millisecond})
+	q := setupTestUniqueAckQueue(t, gopq.AckOpts{AckTimeout: time.Minute, MaxRetries: 1, RetryBackoff: time.Millisecond})
 
 	require.NoError(t, q.Enqueue([]byte("item1")))
 
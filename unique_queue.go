@@ -1,67 +1,166 @@
 package gopq
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/mattdeak/gopq/internal"
 )
 
 const (
-	uniqueCreateTableQuery = `
-        CREATE TABLE IF NOT EXISTS %s (
+	// Items are unique by their deduplication key, or by their content if
+	// they have none.
+	uniqueTableQuery = `
+        CREATE TABLE IF NOT EXISTS %[1]s (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             item BLOB NOT NULL,
-            enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            UNIQUE(item) ON CONFLICT IGNORE
+            enqueued_at INTEGER,
+            processed_at TIMESTAMP,
+            visible_at INTEGER,
+            attributes TEXT,
+            expires_at INTEGER,
+            dedupe_key TEXT,
+            codec TEXT,
+            unique_key BLOB GENERATED ALWAYS AS (COALESCE(dedupe_key, item)) VIRTUAL,
+            UNIQUE(unique_key) ON CONFLICT IGNORE
         );
+    `
+	uniqueCreateTableQuery = uniqueTableQuery + `
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_processed ON %[1]s(processed_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_visible_at ON %[1]s(visible_at);
+        CREATE INDEX IF NOT EXISTS idx_%[1]s_expires_at ON %[1]s(expires_at);
     `
 	uniqueEnqueueQuery = `
-        INSERT INTO %s (item) VALUES (?)
+        INSERT INTO %s (item, expires_at, dedupe_key, codec, enqueued_at) VALUES (?, ?, ?, ?, ?)
     `
 	uniqueTryDequeueQuery = `
 		WITH oldest AS (
 			SELECT id, item
 			FROM %[1]s
-			ORDER BY enqueued_at ASC
+			WHERE (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
 			LIMIT 1
 		)
 		DELETE FROM %[1]s
 		WHERE id = (SELECT id FROM oldest)
-		RETURNING id, item
+		RETURNING id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
+    `
+	uniqueTryDequeueBatchQuery = `
+		WITH batch AS MATERIALIZED (
+			SELECT id, row_number() OVER (ORDER BY enqueued_at ASC, id ASC) AS position
+			FROM %[1]s
+			WHERE (visible_at IS NULL OR visible_at <= ?1)
+				AND (expires_at IS NULL OR expires_at > ?1)
+			ORDER BY enqueued_at ASC, id ASC
+			LIMIT ?2
+		)
+		DELETE FROM %[1]s
+		WHERE id IN (SELECT id FROM batch)
+		RETURNING (SELECT position FROM batch WHERE batch.id = %[1]s.id), id, item, attributes, CAST(enqueued_at AS INTEGER), NULL, NULL, codec
     `
 	uniqueLenQuery = `
-        SELECT COUNT(*) FROM %s
+        SELECT COUNT(*) FROM %s WHERE (visible_at IS NULL OR visible_at <= ?1)
+            AND (expires_at IS NULL OR expires_at > ?1)
     `
 )
 
 // NewUniqueQueue creates a new unique queue.
-func NewUniqueQueue(filePath string) (*Queue, error) {
+func NewUniqueQueue(filePath string, opts ...QueueOptions) (*Queue, error) {
+	qo := Opts{}
+	if err := qo.Apply(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create unique queue: %w", err)
+	}
+
 	db, err := internal.InitializeDB(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create unique queue: %w", err)
 	}
 
 	tableName := internal.DetermineTableName("unique_queue", filePath)
+	return newUniqueQueue(db, tableName, internal.MakeNotifyChan(), qo)
+}
+
+// newUniqueQueue creates a unique queue in the given table of db.
+func newUniqueQueue(db *sql.DB, tableName string, notifyChan chan struct{}, qo Opts) (*Queue, error) {
+	templates, ok := uniqueQueueTemplates[qo.Uniqueness]
+	if !ok {
+		return nil, fmt.Errorf("failed to create unique queue: unknown uniqueness %d", qo.Uniqueness)
+	}
+	retention, err := uniqueRetention(qo.Uniqueness, qo.DedupeWindow, qo.Retention)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique queue: %w", err)
+	}
 
 	formattedCreateTableQuery := fmt.Sprintf(uniqueCreateTableQuery, tableName)
 	formattedEnqueueQuery := fmt.Sprintf(uniqueEnqueueQuery, tableName)
-	formattedTryDequeueQuery := fmt.Sprintf(uniqueTryDequeueQuery, tableName)
-	formattedLenQuery := fmt.Sprintf(uniqueLenQuery, tableName)
+	formattedTryDequeueQuery := fmt.Sprintf(templates.tryDequeue, tableName)
+	formattedTryDequeueBatchQuery := fmt.Sprintf(templates.tryDequeueBatch, tableName)
+	formattedLenQuery := fmt.Sprintf(templates.len, tableName)
+	formattedEnqueueAtQuery := fmt.Sprintf(uniqueDelayedEnqueueQuery, tableName)
+	formattedEnqueueAttributesQuery := fmt.Sprintf(uniqueAttributesEnqueueQuery, tableName)
+	formattedNextVisibleQuery := fmt.Sprintf(templates.nextVisible, tableName)
+	formattedLenExpiredQuery := fmt.Sprintf(ttlLenExpiredQuery, tableName, templates.expiredCondition)
+	formattedPurgeExpiredQuery := fmt.Sprintf(ttlPurgeExpiredQuery, tableName, templates.expiredCondition)
+	formattedPeekQuery := fmt.Sprintf(browseQuery, tableName, templates.readyCondition, fifoOrder)
+	formattedBrowseQuery := fmt.Sprintf(browseQuery, tableName, templates.pendingCondition, fifoOrder)
+	formattedDeleteByIDQuery := fmt.Sprintf(adminDeleteQuery, tableName)
+	formattedPurgePendingQuery := fmt.Sprintf(adminPurgeQuery, tableName, templates.purgeFilter)
+	formattedPurgeAllQuery := fmt.Sprintf(adminPurgeQuery, tableName, "")
+	formattedRequeueQuery := fmt.Sprintf(adminRequeueQuery, tableName, templates.requeueSet)
+	formattedCompactAgeQuery := fmt.Sprintf(compactAgeQuery, tableName)
 
-	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedLenQuery)
+	common, err := qo.CommonOpts.resolve()
+	if err != nil {
+		return nil, err
+	}
+	common.Retention = retention
+
+	err = internal.MigrateTable(db, tableName, uniqueAddedColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique queue: %w", err)
+	}
+	err = internal.MigrateMillis(db, tableName, millisColumns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique queue: %w", err)
+	}
+	err = internal.RebuildTable(db, tableName, dedupeKeyColumn, uniqueTableQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create unique queue: %w", err)
 	}
 
-	return &Queue{
+	err = internal.PrepareDB(db, formattedCreateTableQuery, formattedEnqueueQuery, formattedTryDequeueQuery, formattedTryDequeueBatchQuery, formattedLenQuery, formattedEnqueueAtQuery, formattedEnqueueAttributesQuery, formattedNextVisibleQuery, formattedLenExpiredQuery, formattedPurgeExpiredQuery, formattedPeekQuery, formattedBrowseQuery, formattedDeleteByIDQuery, formattedPurgePendingQuery, formattedPurgeAllQuery, formattedRequeueQuery, formattedCompactAgeQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unique queue: %w", err)
+	}
+
+	q := &Queue{
 		db:           db,
+		name:         tableName,
 		pollInterval: defaultPollInterval,
-		notifyChan:   internal.MakeNotifyChan(),
+		notifyChan:   notifyChan,
 		queries: baseQueries{
-			enqueue:    formattedEnqueueQuery,
-			tryDequeue: formattedTryDequeueQuery,
-			len:        formattedLenQuery,
+			enqueue:           formattedEnqueueQuery,
+			enqueueAt:         formattedEnqueueAtQuery,
+			enqueueAttributes: formattedEnqueueAttributesQuery,
+			tryDequeue:        formattedTryDequeueQuery,
+			tryDequeueBatch:   formattedTryDequeueBatchQuery,
+			len:               formattedLenQuery,
+			nextVisible:       formattedNextVisibleQuery,
+			lenExpired:        formattedLenExpiredQuery,
+			purgeExpired:      formattedPurgeExpiredQuery,
+			peek:              formattedPeekQuery,
+			browse:            formattedBrowseQuery,
+			deleteByID:        formattedDeleteByIDQuery,
+			purgePending:      formattedPurgePendingQuery,
+			purgeAll:          formattedPurgeAllQuery,
+			requeue:           formattedRequeueQuery,
+			compactAge:        formattedCompactAgeQuery,
+			vacuum:            compactVacuumQuery,
 		},
-	}, nil
-
+		opts: common,
+		mode: modeKeyed | modeCodec,
+	}
+	q.startJanitor()
+	return q, nil
 }
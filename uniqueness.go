@@ -0,0 +1,121 @@
+package gopq
+
+import (
+	"fmt"
+	"time"
+)
+
+// Uniqueness determines how long a unique queue refuses duplicates of an
+// item.
+type Uniqueness int
+
+const (
+	// UniqueWhilePending refuses an item while an item with the same
+	// deduplication key is waiting in the queue or, for unique ack queues,
+	// waiting for an acknowledgement. This is the default.
+	UniqueWhilePending Uniqueness = iota
+
+	// UniqueForLifetime also refuses an item whose duplicate has already
+	// been processed. Processed items are kept for the dedupe window, or
+	// forever if there is none.
+	UniqueForLifetime
+)
+
+// uniqueTemplates are the query templates and conditions of a unique queue
+// that depend on its Uniqueness. Queues that remember processed items mark
+// them like the simple and ack queues do instead of deleting them.
+type uniqueTemplates struct {
+	tryDequeue       string
+	tryDequeueBatch  string
+	ack              string
+	len              string
+	nextVisible      string
+	expiredCondition string
+	readyCondition   string
+	pendingCondition string
+	purgeFilter      string
+	requeueSet       string
+}
+
+var (
+	uniqueQueueTemplates = map[Uniqueness]uniqueTemplates{
+		UniqueWhilePending: {
+			tryDequeue:       uniqueTryDequeueQuery,
+			tryDequeueBatch:  uniqueTryDequeueBatchQuery,
+			len:              uniqueLenQuery,
+			nextVisible:      uniqueNextVisibleQuery,
+			expiredCondition: uniqueExpiredCondition,
+			readyCondition:   uniqueReadyCondition,
+			pendingCondition: uniquePendingCondition,
+			requeueSet:       uniqueRequeueSet,
+		},
+		UniqueForLifetime: {
+			tryDequeue:       simpleTryDequeueQuery,
+			tryDequeueBatch:  simpleTryDequeueBatchQuery,
+			len:              simpleLenQuery,
+			nextVisible:      delayedNextVisibleQuery,
+			expiredCondition: expiredCondition,
+			readyCondition:   readyCondition,
+			pendingCondition: pendingCondition,
+			purgeFilter:      unprocessedFilter,
+			requeueSet:       requeueSet,
+		},
+	}
+	uniqueAckQueueTemplates = map[Uniqueness]uniqueTemplates{
+		UniqueWhilePending: {
+			tryDequeue:       uniqueAckTryDequeueQuery,
+			tryDequeueBatch:  uniqueAckTryDequeueBatchQuery,
+			ack:              uniqueAckAckQuery,
+			len:              uniqueAckLenQuery,
+			nextVisible:      uniqueNextVisibleQuery,
+			expiredCondition: uniqueAckExpiredCondition,
+			readyCondition:   uniqueAckReadyCondition,
+			pendingCondition: uniquePendingCondition,
+			requeueSet:       uniqueAckRequeueSet,
+		},
+		UniqueForLifetime: {
+			tryDequeue:       ackTryDequeueQuery,
+			tryDequeueBatch:  ackTryDequeueBatchQuery,
+			ack:              ackAckQuery,
+			len:              ackLenQuery,
+			nextVisible:      delayedNextVisibleQuery,
+			expiredCondition: ackExpiredCondition,
+			readyCondition:   ackReadyCondition,
+			pendingCondition: pendingCondition,
+			purgeFilter:      unprocessedFilter,
+			requeueSet:       ackRequeueSet,
+		},
+	}
+)
+
+// WithLifetimeUniqueness makes a unique queue remember processed items, so
+// a duplicate is refused even after the original has been dequeued. Items
+// are forgotten once they were processed longer than window ago, or never
+// if window is zero. Other queues ignore it.
+func WithLifetimeUniqueness(window time.Duration) QueueOptions {
+	return func(o *Opts) error {
+		if window < 0 {
+			return fmt.Errorf("dedupe window must not be negative: %v", window)
+		}
+		o.Uniqueness = UniqueForLifetime
+		o.DedupeWindow = window
+		return nil
+	}
+}
+
+// uniqueRetention returns the retention policy of a unique queue. Queues
+// that remember processed items keep them for the dedupe window, so their
+// policy may only set how the window is enforced.
+func uniqueRetention(mode Uniqueness, window time.Duration, policy RetentionPolicy) (RetentionPolicy, error) {
+	if mode != UniqueForLifetime {
+		return policy, nil
+	}
+	if window < 0 {
+		return RetentionPolicy{}, fmt.Errorf("dedupe window must not be negative: %v", window)
+	}
+	if policy.enabled() {
+		return RetentionPolicy{}, fmt.Errorf("retention limits cannot be combined with lifetime uniqueness, use the dedupe window instead")
+	}
+	policy.MaxAge = window
+	return policy, nil
+}
@@ -0,0 +1,117 @@
+package gopq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattdeak/gopq"
+	"github.com/mattdeak/gopq/gopqtest"
+)
+
+func TestUniqueQueue_LifetimeUniqueness(t *testing.T) {
+	q, err := gopq.NewUniqueQueue("", gopq.WithLifetimeUniqueness(0))
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("webhook-1")))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "webhook-1", string(msg.Item))
+
+	// The processed item is remembered, so its duplicate is refused.
+	require.NoError(t, q.Enqueue([]byte("webhook-1")))
+	assertQueueLen(t, q, 0)
+	_, err = q.TryDequeue()
+	assert.ErrorIs(t, err, &gopq.ErrNoItemsWaiting{})
+
+	// Without a dedupe window, Compact keeps processed items.
+	n, err := q.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	require.NoError(t, q.Enqueue([]byte("webhook-2")))
+	n, err = q.Purge(ctx, gopq.PurgePending)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = q.Purge(ctx, gopq.PurgeAll)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestUniqueQueue_DedupeWindow(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q, err := gopq.NewUniqueQueue("",
+		gopq.WithLifetimeUniqueness(24*time.Hour),
+		gopq.WithRetention(gopq.RetentionPolicy{Interval: 10 * time.Millisecond}),
+		gopq.WithClock(clock),
+	)
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.EnqueueWithKey(ctx, "delivery-1", []byte("attempt 1")))
+	dequeueN(t, q, 1)
+
+	clock.Advance(23 * time.Hour)
+	require.NoError(t, q.EnqueueWithKey(ctx, "delivery-1", []byte("attempt 2")))
+	assertQueueLen(t, q, 0)
+
+	// Once the window has passed, the janitor forgets the key.
+	clock.Advance(2 * time.Hour)
+	assert.Eventually(t, func() bool {
+		require.NoError(t, q.EnqueueWithKey(ctx, "delivery-1", []byte("attempt 3")))
+		n, err := q.Len()
+		return err == nil && n == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestUniqueAckQueue_LifetimeUniqueness(t *testing.T) {
+	clock := gopqtest.NewClock(time.Now())
+	q := setupTestUniqueAckQueue(t, gopq.AckOpts{
+		AckTimeout: time.Minute,
+		MaxRetries: 1,
+		AckAction:  gopq.AckDelete,
+		CommonOpts: gopq.CommonOpts{
+			Clock:      clock,
+			Uniqueness: gopq.UniqueForLifetime,
+		},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	msg, err := q.TryDequeue()
+	require.NoError(t, err)
+	require.NoError(t, q.TryNackWithDelay(ctx, msg.ID, time.Second))
+	clock.Advance(time.Minute)
+
+	// Negatively acknowledged messages are retried as usual.
+	msg, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, msg.RetryCount)
+	require.NoError(t, q.Ack(msg.ID))
+
+	require.NoError(t, q.Enqueue([]byte("item")))
+	assertLen(t, q, 0)
+
+	msgs, err := q.Browse(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+}
+
+func TestUniqueQueue_LifetimeUniquenessOptions(t *testing.T) {
+	_, err := gopq.NewUniqueQueue("",
+		gopq.WithLifetimeUniqueness(time.Hour),
+		gopq.WithRetention(gopq.RetentionPolicy{MaxProcessed: 10}),
+	)
+	assert.Error(t, err)
+
+	assert.Error(t, gopq.WithLifetimeUniqueness(-time.Hour)(&gopq.Opts{}))
+
+	_, err = gopq.NewUniqueAckQueue("", gopq.AckOpts{CommonOpts: gopq.CommonOpts{Uniqueness: gopq.Uniqueness(7)}})
+	assert.Error(t, err)
+}